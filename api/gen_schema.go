@@ -0,0 +1,22 @@
+//go:build ignore
+
+// gen_schema regenerates the checked-in BigQuery schema files from the api
+// types. Run it with "go generate ./api".
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func main() {
+	for file, v := range api.SchemaFiles {
+		b, err := api.GenerateSchema(v)
+		rtx.Must(err, "failed to generate the schema for %v", file)
+		rtx.Must(os.WriteFile(file, b, 0o644), "failed to write %v", file)
+		log.Println("wrote", file)
+	}
+}
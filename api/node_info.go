@@ -1,15 +1,232 @@
 // Package api defines the datatype generated by this tool.
 package api
 
+import "time"
+
 // CmdOut defines the executed command line (including all flags and
 // parameters) and the output it generated.
 type CmdOut struct {
-	Name        string
-	CommandLine string
-	Output      string
+	Name        string `description:"The name of the gatherer that ran the command"`
+	CommandLine string `description:"The command line that was run, including all flags and parameters"`
+	Output      string `description:"The standard output of the command"`
+	Namespaces  string `json:",omitempty" description:"The namespaces the command ran in, if its gatherer asked to enter the namespaces of another process"`
+	Item        string `json:",omitempty" description:"The item the command was run for, if its gatherer runs once per item"`
+	Limits      string `json:",omitempty" description:"The user, resource limits and priorities the command ran with, if its gatherer set any"`
+	Usage       *Usage `json:",omitempty" description:"The resources used by the command, if it was run rather than replayed"`
+}
+
+// Usage is the resources used by a command and the children it waited for.
+type Usage struct {
+	UserSeconds   float64 `description:"The CPU time spent in user mode in seconds"`
+	SystemSeconds float64 `description:"The CPU time spent in kernel mode in seconds"`
+	MaxRSS        int64   `description:"The maximum resident set size in bytes"`
+	InBlocks      int64   `description:"The number of block input operations"`
+	OutBlocks     int64   `description:"The number of block output operations"`
+}
+
+// Sysctl is a single kernel parameter read from /proc/sys.
+type Sysctl struct {
+	Key   string `description:"The name of the parameter in sysctl's dotted form, e.g. net.core.rmem_max"`
+	Value string `description:"The value of the parameter"`
+}
+
+// NetInterface describes a single network interface, as found in
+// /sys/class/net and, optionally, reported by its driver through ethtool.
+type NetInterface struct {
+	Name            string       `description:"The name of the interface, e.g. eth0"`
+	Address         string       `description:"The hardware address of the interface"`
+	MTU             int          `description:"The maximum transmission unit of the interface in bytes"`
+	OperState       string       `description:"The operational state of the interface, e.g. up or down"`
+	Speed           int          `description:"The link speed in Mb/s, or -1 if it is unknown"`
+	Duplex          string       `description:"The duplex mode of the link, or empty if it is unknown"`
+	Driver          string       `description:"The name of the kernel driver bound to the interface, or empty for virtual interfaces"`
+	DriverVersion   string       `json:",omitempty" description:"The driver version reported by ethtool"`
+	FirmwareVersion string       `json:",omitempty" description:"The firmware version reported by ethtool"`
+	BusInfo         string       `json:",omitempty" description:"The bus address of the device reported by ethtool"`
+	RxRing          int          `json:",omitempty" description:"The number of receive ring entries reported by ethtool"`
+	RxRingMax       int          `json:",omitempty" description:"The maximum number of receive ring entries reported by ethtool"`
+	TxRing          int          `json:",omitempty" description:"The number of transmit ring entries reported by ethtool"`
+	TxRingMax       int          `json:",omitempty" description:"The maximum number of transmit ring entries reported by ethtool"`
+	Features        []NetFeature `json:",omitempty" description:"The offloads reported by ethtool"`
+	EthtoolError    string       `json:",omitempty" description:"Why the interface could not be queried through ethtool, if it was asked to be"`
+}
+
+// NetFeature is a single offload feature of a network interface.
+type NetFeature struct {
+	Name    string `description:"The name of the feature as shown by ethtool -k, e.g. generic-receive-offload"`
+	Enabled bool   `description:"Whether the feature is enabled"`
+}
+
+// BlockDevice describes a single disk, as found in /sys/block.
+type BlockDevice struct {
+	Name       string `description:"The kernel name of the device, e.g. sda"`
+	Size       int64  `description:"The size of the device in bytes"`
+	Rotational bool   `description:"Whether the device is a spinning disk"`
+	Removable  bool   `description:"Whether the device has removable media"`
+	ReadOnly   bool   `description:"Whether the device is read-only"`
+	Vendor     string `description:"The vendor of the device, if known"`
+	Model      string `description:"The model of the device, if known"`
+	Serial     string `description:"The serial number of the device, if known"`
+	Scheduler  string `description:"The active I/O scheduler of the device"`
+}
+
+// Filesystem describes a single mount, as found in /proc/self/mountinfo,
+// along with its usage.
+type Filesystem struct {
+	MountPoint   string `description:"Where the filesystem is mounted"`
+	Type         string `description:"The type of the filesystem, e.g. ext4"`
+	Source       string `description:"The device or other source the filesystem was mounted from"`
+	Options      string `description:"The per-mount options, e.g. rw,noatime"`
+	SuperOptions string `description:"The per-filesystem options"`
+	Size         int64  `description:"The total size of the filesystem in bytes"`
+	Free         int64  `description:"The free space on the filesystem in bytes"`
+	Available    int64  `description:"The free space available to unprivileged users in bytes"`
+	Inodes       int64  `description:"The total number of inodes on the filesystem"`
+	InodesFree   int64  `description:"The number of free inodes on the filesystem"`
+}
+
+// Topology describes the CPUs and memory of the node.
+type Topology struct {
+	Vendor          string          `description:"The vendor of the CPUs, e.g. GenuineIntel"`
+	Model           string          `description:"The model name of the CPUs"`
+	Family          int             `description:"The CPU family number"`
+	ModelNumber     int             `description:"The CPU model number"`
+	Stepping        int             `description:"The CPU stepping"`
+	Microcode       string          `description:"The loaded microcode revision"`
+	Sockets         int             `description:"The number of physical CPU packages"`
+	Cores           int             `description:"The number of physical cores across all packages"`
+	Threads         int             `description:"The number of logical CPUs"`
+	Online          string          `description:"The list of online logical CPUs, e.g. 0-7"`
+	MaxFrequency    int64           `description:"The highest maximum frequency of any CPU in kHz, or 0 if unknown"`
+	Governors       []string        `description:"The distinct frequency scaling governors in use"`
+	Vulnerabilities []Vulnerability `description:"The mitigation status of every CPU vulnerability known to the kernel"`
+	NUMANodes       []NUMANode      `description:"The NUMA nodes of the machine"`
+	MemoryTotal     int64           `description:"The total usable memory in bytes"`
+	SwapTotal       int64           `description:"The total swap space in bytes"`
+	HugePages       int64           `description:"The number of huge pages in the pool"`
+	HugePageSize    int64           `description:"The size of a huge page in bytes"`
+}
+
+// Vulnerability is the status of a single CPU vulnerability.
+type Vulnerability struct {
+	Name   string `description:"The name of the vulnerability, e.g. spectre_v2"`
+	Status string `description:"Whether the CPU is affected and how it is mitigated"`
+}
+
+// NUMANode describes a single NUMA node.
+type NUMANode struct {
+	ID          int    `description:"The number of the node"`
+	CPUs        string `description:"The list of logical CPUs on the node, e.g. 0-3,8-11"`
+	MemoryTotal int64  `description:"The memory attached to the node in bytes"`
 }
 
-// NodeInfoV1 defines the list of executed commands and their outputs.
+// Module describes a single loaded kernel module, as found in /proc/modules
+// and /sys/module.
+type Module struct {
+	Name       string   `description:"The name of the module"`
+	Size       int64    `description:"The memory used by the module in bytes"`
+	RefCount   int      `description:"The number of references to the module"`
+	UsedBy     []string `description:"The modules that depend on this module and hold references to it, as listed in /proc/modules"`
+	State      string   `description:"The state of the module, e.g. Live"`
+	Version    string   `description:"The version declared by the module, if any"`
+	SrcVersion string   `description:"The checksum of the source the module was built from, if known"`
+	Taints     string   `description:"The taint flags of the module, e.g. OE, or empty if it doesn't taint the kernel"`
+}
+
+// Taint is the taint state of the running kernel.
+type Taint struct {
+	Value int64    `description:"The raw value of /proc/sys/kernel/tainted"`
+	Flags []string `description:"The names of the taint flags that are set, e.g. oot_module"`
+}
+
+// Package describes a single installed package, normalized across package
+// managers.
+type Package struct {
+	Name    string `description:"The name of the package"`
+	Version string `description:"The version of the package, as the package manager spells it"`
+	Arch    string `description:"The architecture the package was built for"`
+	Source  string `description:"The source package or origin the package was built from"`
+	Manager string `description:"The package manager that installed the package, i.e. dpkg, apk or rpm"`
+}
+
+// Kubernetes describes the pod and container nodeinfo runs in.
+type Kubernetes struct {
+	PodName     string     `description:"The name of the pod, from the POD_NAME environment variable"`
+	Namespace   string     `description:"The namespace of the pod, from the POD_NAMESPACE environment variable"`
+	PodUID      string     `description:"The UID of the pod, from the POD_UID environment variable"`
+	PodIP       string     `description:"The IP address of the pod, from the POD_IP environment variable"`
+	NodeName    string     `description:"The name of the node running the pod, from the NODE_NAME environment variable"`
+	Revision    string     `description:"The revision of the pod template, from the controller-revision-hash or pod-template-hash label"`
+	Labels      []KeyValue `description:"The labels of the pod, from the downward API labels file"`
+	Annotations []KeyValue `description:"The annotations of the pod, from the downward API annotations file"`
+	Cgroup      string     `description:"The cgroup path of the nodeinfo process"`
+	Runtime     string     `description:"The container runtime, as named in the cgroup path, e.g. containerd"`
+	ContainerID string     `description:"The ID of the container, as found in the cgroup path"`
+}
+
+// KeyValue is a single label or annotation.
+type KeyValue struct {
+	Key   string `description:"The key of the entry"`
+	Value string `description:"The value of the entry"`
+}
+
+// TimeSync describes the state of the kernel clock.
+type TimeSync struct {
+	State                 string   `description:"The clock state returned by adjtimex, e.g. ok or error"`
+	Synchronized          bool     `description:"Whether the kernel considers the clock synchronized"`
+	Status                int64    `description:"The raw STA_* status bits of the clock"`
+	Offset                int64    `description:"The estimated offset of the clock in nanoseconds"`
+	Frequency             float64  `description:"The frequency adjustment of the clock in parts per million"`
+	MaxError              int64    `description:"The maximum error of the clock in microseconds"`
+	EstError              int64    `description:"The estimated error of the clock in microseconds"`
+	ClockSource           string   `description:"The clock source in use, e.g. tsc"`
+	AvailableClockSources []string `description:"The clock sources the kernel could use"`
+}
+
+// NodeInfoV1 defines the list of executed commands and their outputs, along
+// with the structured records of the built-in collectors.
 type NodeInfoV1 struct {
-	Commands []CmdOut `json:"commands"`
+	Commands     []CmdOut       `json:"commands" description:"Every command run during a single gathering pass"`
+	Sysctl       []Sysctl       `json:"sysctl,omitempty" description:"Kernel parameters collected by sysctl gatherers, sorted by key"`
+	Interfaces   []NetInterface `json:"interfaces,omitempty" description:"Network interfaces collected by netif gatherers, sorted by name"`
+	BlockDevices []BlockDevice  `json:"block_devices,omitempty" description:"Disks collected by block gatherers, sorted by name"`
+	Filesystems  []Filesystem   `json:"filesystems,omitempty" description:"Mounts collected by filesystem gatherers, sorted by mount point"`
+	Topology     *Topology      `json:"topology,omitempty" description:"The CPUs and memory collected by a topology gatherer"`
+	Modules      []Module       `json:"modules,omitempty" description:"Kernel modules collected by modules gatherers, sorted by name"`
+	Taint        *Taint         `json:"taint,omitempty" description:"The kernel taint state collected by a modules gatherer"`
+	Packages     []Package      `json:"packages,omitempty" description:"Installed packages collected by packages gatherers, sorted by name and architecture"`
+	Kubernetes   *Kubernetes    `json:"kubernetes,omitempty" description:"The pod and container nodeinfo runs in, collected by a kubernetes gatherer"`
+	TimeSync     *TimeSync      `json:"time_sync,omitempty" description:"The state of the kernel clock, collected by a timesync gatherer"`
+}
+
+// CmdRowV1 is a single CmdOut flattened together with the metadata of the run
+// that produced it. It is the row type of the NDJSON output layout, which
+// saves one row per command instead of one NodeInfoV1 document per run.
+type CmdRowV1 struct {
+	RunTime     time.Time `description:"When the gathering pass that ran the command was saved"`
+	Index       int       `description:"The position of the command within its gathering pass"`
+	Name        string    `description:"The name of the gatherer that ran the command"`
+	CommandLine string    `description:"The command line that was run, including all flags and parameters"`
+	Output      string    `description:"The standard output of the command"`
+	Namespaces  string    `json:",omitempty" description:"The namespaces the command ran in, if its gatherer asked to enter the namespaces of another process"`
+	Item        string    `json:",omitempty" description:"The item the command was run for, if its gatherer runs once per item"`
+	Limits      string    `json:",omitempty" description:"The user, resource limits and priorities the command ran with, if its gatherer set any"`
+	Usage       *Usage    `json:",omitempty" description:"The resources used by the command, if it was run rather than replayed"`
+}
+
+// ChangeV1 records that the output of a single gatherer differs from its
+// output in the previous run.
+type ChangeV1 struct {
+	Name         string    `description:"The name of the gatherer whose output changed"`
+	PreviousHash string    `description:"The SHA-256 of the previous output, or empty if the gatherer is new"`
+	NewHash      string    `description:"The SHA-256 of the new output, or empty if the gatherer was removed"`
+	Diff         string    `description:"A compact diff from the previous output to the new output, cut to at most 64 KiB"`
+	PreviousTime time.Time `description:"When the previous output was gathered"`
+	Time         time.Time `description:"When the new output was gathered"`
+}
+
+// NodeInfoChangeV1 defines the list of gatherers whose output changed during a
+// single gathering pass.
+type NodeInfoChangeV1 struct {
+	Changes []ChangeV1 `json:"changes" description:"Every gatherer whose output changed since the previous gathering pass"`
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"testing"
+	"time"
 )
 
 // TestV1 fails if there is backwards-incompatible change to NodeInfoV1.
@@ -19,6 +20,42 @@ func TestV1(t *testing.T) {
 				Output:      "",
 			},
 		},
+		Sysctl: []Sysctl{
+			{
+				Key:   "net.core.rmem_max",
+				Value: "212992",
+			},
+		},
 	}
 	t.Logf("nodeinfo1=%#v\n", nodeinfo1)
 }
+
+// TestRowV1 fails if there is backwards-incompatible change to CmdRowV1.
+func TestRowV1(t *testing.T) {
+	row := CmdRowV1{
+		RunTime:     time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+		Index:       0,
+		Name:        "name1",
+		CommandLine: "cmdLine1",
+		Output:      "",
+	}
+	t.Logf("row=%#v\n", row)
+}
+
+// TestChangeV1 fails if there is backwards-incompatible change to
+// NodeInfoChangeV1.
+func TestChangeV1(t *testing.T) {
+	changes := NodeInfoChangeV1{
+		Changes: []ChangeV1{
+			{
+				Name:         "name1",
+				PreviousHash: "hash1",
+				NewHash:      "hash2",
+				Diff:         "",
+				PreviousTime: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+				Time:         time.Date(2023, 6, 1, 1, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	t.Logf("changes=%#v\n", changes)
+}
@@ -0,0 +1,107 @@
+package api
+
+//go:generate go run gen_schema.go
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaFiles maps the name of every checked-in BigQuery schema file to the
+// type it describes.
+var SchemaFiles = map[string]interface{}{
+	"nodeinfo1.json":       NodeInfoV1{},
+	"nodeinforow1.json":    CmdRowV1{},
+	"nodeinfochange1.json": NodeInfoChangeV1{},
+}
+
+// FieldSchema is a single field of a BigQuery JSON schema.
+type FieldSchema struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Mode        string        `json:"mode"`
+	Description string        `json:"description,omitempty"`
+	Fields      []FieldSchema `json:"fields,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// GenerateSchema returns the BigQuery JSON schema of the passed-in struct,
+// formatted the way the checked-in schema files are. Field names come from the
+// json tag (or the Go name if there is none) and descriptions come from the
+// description tag.
+func GenerateSchema(v interface{}) ([]byte, error) {
+	fields, err := structSchema(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func structSchema(t reflect.Type) ([]FieldSchema, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct", t)
+	}
+	var fields []FieldSchema
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		field, err := fieldSchema(name, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %v", t.Name(), f.Name, err)
+		}
+		field.Description = f.Tag.Get("description")
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func fieldSchema(name string, t reflect.Type) (FieldSchema, error) {
+	field := FieldSchema{Name: name, Mode: "NULLABLE"}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		field.Mode = "REPEATED"
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		field.Type = "TIMESTAMP"
+	case t.Kind() == reflect.Struct:
+		field.Type = "RECORD"
+		fields, err := structSchema(t)
+		if err != nil {
+			return field, err
+		}
+		field.Fields = fields
+	case t.Kind() == reflect.String:
+		field.Type = "STRING"
+	case t.Kind() == reflect.Bool:
+		field.Type = "BOOLEAN"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		field.Type = "INTEGER"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		field.Type = "FLOAT"
+	case t.Kind() == reflect.Slice:
+		field.Type = "BYTES"
+	default:
+		return field, fmt.Errorf("unsupported type %v", t)
+	}
+	return field, nil
+}
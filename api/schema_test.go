@@ -0,0 +1,35 @@
+package api
+
+import (
+	"os"
+	"testing"
+)
+
+// TestSchemaFilesUpToDate fails if a checked-in schema file no longer matches
+// its Go type. Run "go generate ./api" to fix it.
+func TestSchemaFilesUpToDate(t *testing.T) {
+	for file, v := range SchemaFiles {
+		want, err := GenerateSchema(v)
+		if err != nil {
+			t.Fatalf("GenerateSchema(%T) = %v, wanted nil", v, err)
+		}
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q) = %v, wanted nil", file, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%v is out of date; run \"go generate ./api\". Wanted:\n%s", file, want)
+		}
+	}
+}
+
+func TestGenerateSchemaErrors(t *testing.T) {
+	type unsupported struct {
+		Channel chan int
+	}
+	for _, v := range []interface{}{"not a struct", unsupported{}} {
+		if _, err := GenerateSchema(v); err == nil {
+			t.Errorf("GenerateSchema(%T) = nil, wanted error", v)
+		}
+	}
+}
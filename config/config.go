@@ -54,13 +54,40 @@ func (c *fileconfig) Reload() error {
 		return err
 	}
 	for _, g := range newGatherers {
-		if g.Name == "" || len(g.Cmd) == 0 {
+		if g.Name == "" {
 			log.Printf("%#v is not a valid gatherer", g)
 			return fmt.Errorf("%#v is not a valid gatherer", g)
 		}
+		if err := g.Validate(); err != nil {
+			log.Printf("%#v is not a valid gatherer: %v", g, err)
+			return fmt.Errorf("%#v is not a valid gatherer: %v", g, err)
+		}
+		if err := data.ActivePolicy.CheckGatherer(g); err != nil {
+			log.Printf("gatherer %q is refused: %v", g.Name, err)
+			metrics.PolicyViolations.WithLabelValues("config").Inc()
+			return err
+		}
 		if err := uniformnames.Check(g.Name); err != nil {
 			return err
 		}
+		if g.Namespaces != nil {
+			if err := g.Namespaces.Validate(); err != nil {
+				log.Printf("gatherer %q has invalid namespaces: %v", g.Name, err)
+				return err
+			}
+		}
+		if g.Limits != nil {
+			if err := g.Limits.Validate(); err != nil {
+				log.Printf("gatherer %q has invalid limits: %v", g.Name, err)
+				return err
+			}
+		}
+		for i := range g.Redactions {
+			if err := g.Redactions[i].Compile(); err != nil {
+				log.Printf("gatherer %q has an invalid redaction: %v", g.Name, err)
+				return err
+			}
+		}
 	}
 	c.gatherers = newGatherers
 	metrics.ConfigLoadTime.SetToCurrentTime()
@@ -1,15 +1,20 @@
 package config_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/m-lab/nodeinfo/config"
 	"github.com/m-lab/nodeinfo/data"
+	"github.com/m-lab/nodeinfo/metrics"
 
 	"github.com/m-lab/go/rtx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestConfigCreationAndReload(t *testing.T) {
@@ -90,6 +95,59 @@ func TestConfigCreationAndReload(t *testing.T) {
 			}
 		]
 		`,
+		// Unknown redaction action.
+		`[
+			{
+				"Name": "ls",
+				"Cmd": ["ls", "-l"],
+				"Redactions": [{"Action": "encrypt", "Pattern": "root"}]
+			}
+		]
+		`,
+		// Unknown built-in collector.
+		`[
+			{
+				"Name": "magic",
+				"Type": "magic"
+			}
+		]
+		`,
+		// Redactions on a built-in collector.
+		`[
+			{
+				"Name": "netif",
+				"Type": "netif",
+				"Redactions": [{"Action": "replace", "Pattern": "([0-9a-f]{2}:){5}[0-9a-f]{2}", "Replacement": "X"}]
+			}
+		]
+		`,
+		// Unknown namespace type.
+		`[
+			{
+				"Name": "ipaddress",
+				"Cmd": ["ip", "address", "show"],
+				"Namespaces": {"Target": 1, "Types": ["network"]}
+			}
+		]
+		`,
+		// Out of range limits.
+		`[
+			{
+				"Name": "lshw",
+				"Cmd": ["lshw", "-json"],
+				"Limits": {"User": "nobody", "Nice": 40}
+			}
+		]
+		`,
+		// Invalid redaction pattern.
+		`[
+			{
+				"Name": "ls",
+				"Cmd": ["ls", "-l"],
+				"Redactions": [{"Action": "drop", "Pattern": "(root"}]
+			}
+		]
+		`,
 	}
 	for _, inc := range incompleteFileContents {
 		rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(inc), 0o666), "failed to write replacement config")
@@ -105,3 +163,95 @@ func TestConfigOnBadFile(t *testing.T) {
 		t.Error("This should not have succeeded")
 	}
 }
+
+func TestConfigRedactions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestConfigRedactions")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	data.RedactionSalt = []byte("salt")
+	defer func() { data.RedactionSalt = nil }()
+
+	filecontents := `[
+		{
+			"Name": "ipneigh",
+			"Cmd": ["ip", "neigh"],
+			"Redactions": [
+				{"Action": "hash", "Pattern": "([0-9a-f]{2}:){5}[0-9a-f]{2}"},
+				{"Action": "replace", "Pattern": "dev \\S+", "Replacement": "dev X"}
+			]
+		}
+	]
+	`
+	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(filecontents), 0o666), "failed to write config")
+	c, err := config.Create(dir + "/config.json")
+	rtx.Must(err, "failed to read config.json")
+	g := c.Gatherers()
+	if len(g) != 1 || len(g[0].Redactions) != 2 {
+		t.Fatalf("Gatherers() = %#v, wanted one gatherer with two redactions", g)
+	}
+	if r := g[0].Redactions[1]; r.Action != data.RedactReplace || r.Pattern != `dev \S+` || r.Replacement != "dev X" {
+		t.Errorf("Redactions[1] = %#v", r)
+	}
+}
+
+func TestConfigBuiltinCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestConfigBuiltinCollector")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+
+	filecontents := `[
+		{
+			"Name": "sysctl",
+			"Type": "sysctl",
+			"Include": ["net.ipv4.tcp_*", "net.core.*"],
+			"Exclude": ["net.core.bpf_*"]
+		}
+	]
+	`
+	expected := []data.Gatherer{
+		{
+			Name:    "sysctl",
+			Type:    "sysctl",
+			Include: []string{"net.ipv4.tcp_*", "net.core.*"},
+			Exclude: []string{"net.core.bpf_*"},
+		},
+	}
+	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(filecontents), 0o666), "failed to write config")
+	c, err := config.Create(dir + "/config.json")
+	rtx.Must(err, "failed to read config.json")
+	if g := c.Gatherers(); !reflect.DeepEqual(g, expected) {
+		t.Errorf("%v != %v", g, expected)
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestConfigPolicy")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	defer func() { data.ActivePolicy = nil }()
+
+	uname, err := exec.LookPath("uname")
+	rtx.Must(err, "failed to find uname")
+	uname, err = filepath.EvalSymlinks(uname)
+	rtx.Must(err, "failed to resolve uname")
+	policy := `{"Rules": [{"Path": "` + uname + `", "Args": ["-a"]}]}`
+	rtx.Must(ioutil.WriteFile(dir+"/policy.json", []byte(policy), 0o666), "failed to write policy")
+	data.ActivePolicy, err = data.LoadPolicy(dir + "/policy.json")
+	rtx.Must(err, "failed to load policy")
+
+	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(`[{"Name": "uname", "Cmd": ["uname", "-a"]}]`), 0o666), "failed to write config")
+	c, err := config.Create(dir + "/config.json")
+	rtx.Must(err, "failed to read an allowed config")
+
+	before := testutil.ToFloat64(metrics.PolicyViolations.WithLabelValues("config"))
+	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(`[{"Name": "shell", "Cmd": ["sh", "-c", "id"]}]`), 0o666), "failed to write config")
+	if err := c.Reload(); !errors.Is(err, data.ErrPolicyViolation) {
+		t.Errorf("Reload() = %v, wanted a policy violation", err)
+	}
+	if got := testutil.ToFloat64(metrics.PolicyViolations.WithLabelValues("config")) - before; got != 1 {
+		t.Errorf("PolicyViolations increased by %v, wanted 1", got)
+	}
+	if g := c.Gatherers(); len(g) != 1 || g[0].Name != "uname" {
+		t.Errorf("Gatherers() = %#v, wanted the allowed config to be kept", g)
+	}
+}
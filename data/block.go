@@ -0,0 +1,79 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// blockCollector records the size, identity and I/O scheduler of every disk in
+// /sys/block. Partitions don't appear there, but loop and ram devices do, so
+// configs usually exclude "loop*" and "ram*" by name.
+type blockCollector struct{}
+
+func (blockCollector) validate(g Gatherer) error {
+	return validatePatterns(g)
+}
+
+// activeScheduler returns the I/O scheduler in brackets in the contents of
+// queue/scheduler, e.g. "mq-deadline" for "none [mq-deadline] kyber".
+func activeScheduler(schedulers string) string {
+	start := strings.IndexByte(schedulers, '[')
+	end := strings.IndexByte(schedulers, ']')
+	if start < 0 || end < start {
+		return schedulers
+	}
+	return schedulers[start+1 : end]
+}
+
+func (blockCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	sysBlock := g.path("/sys/block")
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return 0, err
+	}
+	size := 0
+	byName := make(map[string]api.BlockDevice)
+	for _, d := range nodeinfo.BlockDevices {
+		byName[d.Name] = d
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !selected(g, name) {
+			continue
+		}
+		dir := filepath.Join(sysBlock, name)
+		d := api.BlockDevice{
+			Name:       name,
+			Rotational: readSysfs(filepath.Join(dir, "queue", "rotational")) == "1",
+			Removable:  readSysfs(filepath.Join(dir, "removable")) == "1",
+			ReadOnly:   readSysfs(filepath.Join(dir, "ro")) == "1",
+			Vendor:     readSysfs(filepath.Join(dir, "device", "vendor")),
+			Model:      readSysfs(filepath.Join(dir, "device", "model")),
+			Scheduler:  activeScheduler(readSysfs(filepath.Join(dir, "queue", "scheduler"))),
+		}
+		// The size is always in 512-byte sectors, whatever the block size.
+		if sectors, err := strconv.ParseInt(readSysfs(filepath.Join(dir, "size")), 10, 64); err == nil {
+			d.Size = sectors * 512
+		}
+		// NVMe devices keep their serial number with the controller, and
+		// virtio devices keep it with the disk.
+		d.Serial = readSysfs(filepath.Join(dir, "device", "serial"))
+		if d.Serial == "" {
+			d.Serial = readSysfs(filepath.Join(dir, "serial"))
+		}
+		size += len(d.Name) + len(d.Vendor) + len(d.Model) + len(d.Serial) + len(d.Scheduler)
+		byName[name] = d
+	}
+
+	nodeinfo.BlockDevices = nodeinfo.BlockDevices[:0]
+	for _, d := range byName {
+		nodeinfo.BlockDevices = append(nodeinfo.BlockDevices, d)
+	}
+	sort.Slice(nodeinfo.BlockDevices, func(i, j int) bool { return nodeinfo.BlockDevices[i].Name < nodeinfo.BlockDevices[j].Name })
+	return size, nil
+}
@@ -0,0 +1,19 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestActiveScheduler(t *testing.T) {
+	tests := map[string]string{
+		"none [mq-deadline] kyber bfq": "mq-deadline",
+		"[none]":                       "none",
+		"none":                         "none",
+		"":                             "",
+	}
+	for schedulers, want := range tests {
+		if got := activeScheduler(schedulers); got != want {
+			t.Errorf("activeScheduler(%q) = %q, wanted %q", schedulers, got, want)
+		}
+	}
+}
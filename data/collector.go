@@ -0,0 +1,112 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// collector is a built-in gatherer that reads the state of the node directly
+// instead of running a command, and adds structured records to the document.
+type collector interface {
+	// validate checks the collector-specific configuration of the gatherer.
+	validate(g Gatherer) error
+	// collect adds the collected records to the document and returns their
+	// size in bytes.
+	collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error)
+}
+
+// collectors maps the Type of every built-in gatherer to its collector.
+var collectors = map[string]collector{
+	"block":      blockCollector{},
+	"filesystem": filesystemCollector{},
+	"kubernetes": kubernetesCollector{},
+	"modules":    modulesCollector{},
+	"netif":      netifCollector{},
+	"packages":   packagesCollector{},
+	"sysctl":     sysctlCollector{},
+	"timesync":   timesyncCollector{},
+	"topology":   topologyCollector{},
+}
+
+// Validate checks that the gatherer either has a command to run or is a
+// correctly configured built-in collector.
+func (g Gatherer) Validate() error {
+	if g.Namespaces != nil && g.Limits.dropsRoot() {
+		// nsenter runs as the user too, and only root can enter namespaces.
+		return errors.New("gatherers with Namespaces can't run as a user other than root")
+	}
+	if g.Type == "" {
+		if g.ForEach != nil {
+			return g.ForEach.validate(g.Cmd)
+		}
+		if len(g.Cmd) == 0 {
+			return errors.New("gatherer has no command")
+		}
+		return nil
+	}
+	c, ok := collectors[g.Type]
+	if !ok {
+		return fmt.Errorf("unknown gatherer type %q", g.Type)
+	}
+	if SpoolLayout == LayoutNDJSON {
+		return fmt.Errorf("built-in collectors can't be saved with the %v layout", LayoutNDJSON)
+	}
+	if len(g.Redactions) > 0 {
+		// Redactions apply to command output, and built-in collectors have
+		// none, so rules on them would silently protect nothing.
+		return errors.New("built-in collectors do not support redactions")
+	}
+	if (g.Namespaces != nil || g.Limits != nil) && g.Type != "packages" {
+		// Only the packages collector runs a command, its rpm query.
+		return fmt.Errorf("the %v collector runs no commands, so it does not support Namespaces or Limits", g.Type)
+	}
+	if _, ok := CommandRunner.(ReplayRunner); ok && (!g.UseHostRoot || HostRoot == "") {
+		// Collectors read files rather than running commands, so they are
+		// only replayed by reading a recorded tree under HostRoot.
+		return fmt.Errorf("the %v collector can only be replayed from a host tree with UseHostRoot", g.Type)
+	}
+	return c.validate(g)
+}
+
+// validatePatterns checks that the gatherer's Include and Exclude patterns
+// are valid globs.
+func validatePatterns(g Gatherer) error {
+	for _, pattern := range append(g.Include, g.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selected reports whether the gatherer's patterns select the name. Every name
+// not excluded is selected if there are no Include patterns.
+func selected(g Gatherer, name string) bool {
+	return (len(g.Include) == 0 || matches(g.Include, name)) && !matches(g.Exclude, name)
+}
+
+// path returns where the collector should read an absolute path from.
+func (g Gatherer) path(p string) string {
+	if g.UseHostRoot {
+		return hostPath(p)
+	}
+	return p
+}
+
+// collect runs the built-in collector of the gatherer.
+func (g Gatherer) collect(nodeinfo *api.NodeInfoV1) int {
+	log.Printf("   %v (built-in %v)\n", g.Name, g.Type)
+	c, ok := collectors[g.Type]
+	if !ok {
+		log.Panicf("unknown gatherer type %q", g.Type)
+	}
+	size, err := c.collect(g, nodeinfo)
+	if err != nil {
+		log.Panicf("failed to collect %v (error: %v)", g.Name, err)
+	}
+	return size
+}
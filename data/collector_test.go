@@ -0,0 +1,191 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// gatherTestdata validates the gatherer and runs it against the fake host in
+// the testdata directory, failing the test unless both succeed and something
+// was recorded.
+func gatherTestdata(t *testing.T, g Gatherer) *api.NodeInfoV1 {
+	t.Helper()
+	HostRoot = "../testdata"
+	defer func() { HostRoot = "" }()
+	g.UseHostRoot = true
+	if err := g.Validate(); err != nil {
+		t.Fatalf("%v: Validate() = %v, wanted nil", g.Name, err)
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	r := g.Gather(false, nodeinfo)
+	if r.Err != nil {
+		t.Fatalf("%v: Gather() = %v, wanted nil", g.Name, r.Err)
+	}
+	if r.Bytes == 0 {
+		t.Errorf("%v: Gather() reported no bytes", g.Name)
+	}
+	return nodeinfo
+}
+
+func TestCollectors(t *testing.T) {
+	tests := []struct {
+		g    Gatherer
+		want api.NodeInfoV1
+	}{
+		{
+			g: Gatherer{Name: "block", Type: "block", Exclude: []string{"loop*"}},
+			want: api.NodeInfoV1{BlockDevices: []api.BlockDevice{
+				{
+					Name:      "nvme0n1",
+					Size:      512110190592,
+					Model:     "Samsung SSD 970 EVO Plus 500GB",
+					Serial:    "S4EVNX0M123456K",
+					Scheduler: "none",
+				},
+				{
+					Name:       "sda",
+					Size:       2000398934016,
+					Rotational: true,
+					Vendor:     "ATA",
+					Model:      "ST2000NM0055-1V4",
+					Scheduler:  "bfq",
+				},
+			}},
+		},
+		{
+			g: Gatherer{Name: "modules", Type: "modules", Exclude: []string{"tcp_*"}},
+			want: api.NodeInfoV1{
+				Taint: &api.Taint{Value: 12289, Flags: []string{"proprietary_module", "oot_module", "unsigned_module"}},
+				Modules: []api.Module{
+					{Name: "ixgbe", Size: 339968, State: "Live", Version: "5.1.0-k", SrcVersion: "0F2F0C4F7CC0B0E43C6C7B4"},
+					{
+						Name:       "nf_nat",
+						Size:       49152,
+						RefCount:   2,
+						UsedBy:     []string{"xt_MASQUERADE", "iptable_nat"},
+						State:      "Live",
+						SrcVersion: "6DD1C1F5A3A9A7B0C1D2E3F",
+					},
+					{Name: "zfs", Size: 3903488, RefCount: 6, State: "Live", Version: "2.1.5-1", SrcVersion: "1D2BA7A5E7F6A3D84B9D6B0", Taints: "POE"},
+				},
+			},
+		},
+		{
+			g: Gatherer{Name: "netif", Type: "netif", Exclude: []string{"lo"}},
+			want: api.NodeInfoV1{Interfaces: []api.NetInterface{
+				{Name: "dummy9", Address: "aa:bb:cc:dd:ee:ff", MTU: 1500, OperState: "down", Speed: -1, Duplex: "unknown"},
+				{Name: "eth0", Address: "00:25:90:aa:bb:cc", MTU: 1500, OperState: "up", Speed: 10000, Duplex: "full", Driver: "ixgbe"},
+			}},
+		},
+		{
+			g: Gatherer{
+				Name:    "sysctl",
+				Type:    "sysctl",
+				Include: []string{"net.ipv4.tcp_*", "net.core.*", "net.missing.*"},
+				Exclude: []string{"net.core.bpf_*"},
+			},
+			want: api.NodeInfoV1{Sysctl: []api.Sysctl{
+				{Key: "net.core.default_qdisc", Value: "fq"},
+				{Key: "net.core.rmem_max", Value: "212992"},
+				{Key: "net.core.wmem_max", Value: "212992"},
+				{Key: "net.ipv4.tcp_congestion_control", Value: "bbr"},
+				{Key: "net.ipv4.tcp_rmem", Value: "4096\t131072\t6291456"},
+				{Key: "net.ipv4.tcp_sack", Value: "1"},
+			}},
+		},
+		{
+			g: Gatherer{Name: "topology", Type: "topology"},
+			want: api.NodeInfoV1{Topology: &api.Topology{
+				Vendor:       "GenuineIntel",
+				Model:        "Intel(R) Xeon(R) Silver 4110 CPU @ 2.10GHz",
+				Family:       6,
+				ModelNumber:  85,
+				Stepping:     4,
+				Microcode:    "0x2006e05",
+				Sockets:      1,
+				Cores:        2,
+				Threads:      4,
+				Online:       "0-3",
+				MaxFrequency: 3000000,
+				Governors:    []string{"performance", "powersave"},
+				Vulnerabilities: []api.Vulnerability{
+					{Name: "meltdown", Status: "Mitigation: PTI"},
+					{Name: "spectre_v1", Status: "Mitigation: usercopy/swapgs barriers and __user pointer sanitization"},
+				},
+				NUMANodes: []api.NUMANode{
+					{ID: 0, CPUs: "0-1", MemoryTotal: 8168806 * 1024},
+					{ID: 1, CPUs: "2-3", MemoryTotal: 8168806 * 1024},
+				},
+				MemoryTotal:  16337612 * 1024,
+				SwapTotal:    2097148 * 1024,
+				HugePages:    4,
+				HugePageSize: 2048 * 1024,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		// Comparing whole documents also checks that collectors record no
+		// commands and leave the sections of other collectors alone.
+		if got := gatherTestdata(t, tt.g); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%v: Gather() =\n%#v\nwanted\n%#v", tt.g.Name, *got, tt.want)
+		}
+	}
+}
+
+func TestGathererValidate(t *testing.T) {
+	tests := []struct {
+		g       Gatherer
+		wantErr bool
+	}{
+		{g: Gatherer{Name: "uname", Cmd: []string{"uname"}}},
+		{g: Gatherer{Name: "uname"}, wantErr: true},
+		{g: Gatherer{Name: "sysctl", Type: "sysctl", Include: []string{"net.*"}}},
+		{g: Gatherer{Name: "sysctl", Type: "sysctl"}, wantErr: true},
+		{g: Gatherer{Name: "sysctl", Type: "sysctl", Include: []string{"net.["}}, wantErr: true},
+		{g: Gatherer{Name: "netif", Type: "netif"}},
+		{g: Gatherer{Name: "netif", Type: "netif", Redactions: []Redaction{{Action: RedactDrop, Pattern: "eth0"}}}, wantErr: true},
+		{g: Gatherer{Name: "netif", Type: "netif", Exclude: []string{"["}}, wantErr: true},
+		{g: Gatherer{Name: "netif", Type: "netif", Ethtool: true}},
+		{g: Gatherer{Name: "netif", Type: "netif", Ethtool: true, UseHostRoot: true}, wantErr: true},
+		{g: Gatherer{Name: "block", Type: "block", Exclude: []string{"loop*"}}},
+		{g: Gatherer{Name: "filesystem", Type: "filesystem", Include: []string{"["}}, wantErr: true},
+		{g: Gatherer{Name: "magic", Type: "magic"}, wantErr: true},
+		{g: Gatherer{Name: "ss", Cmd: []string{"ss"}, Namespaces: &Namespaces{Target: 1, Types: []string{"net"}}, Limits: &Limits{User: "root"}}},
+		{g: Gatherer{Name: "netif", Type: "netif", Namespaces: &Namespaces{Target: 1, Types: []string{"net"}}}, wantErr: true},
+		{g: Gatherer{Name: "netif", Type: "netif", Limits: &Limits{CPUSeconds: 1}}, wantErr: true},
+		{g: Gatherer{Name: "packages", Type: "packages", Limits: &Limits{CPUSeconds: 1}}},
+		{g: Gatherer{Name: "ss", Cmd: []string{"ss"}, Namespaces: &Namespaces{Target: 1, Types: []string{"net"}}, Limits: &Limits{User: "nobody"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.g.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%#v.Validate() = %v, wantErr %v", tt.g, err, tt.wantErr)
+		}
+	}
+
+	// Collectors read the node, so they can't be replayed from fixtures unless
+	// the node is a tree under HostRoot.
+	CommandRunner = ReplayRunner{Dir: "../testdata/fixtures"}
+	defer func() {
+		CommandRunner = ExecRunner{}
+		HostRoot = ""
+	}()
+	if err := (Gatherer{Name: "netif", Type: "netif"}).Validate(); err == nil {
+		t.Error("Validate() of a collector while replaying = nil, wanted error")
+	}
+	HostRoot = "../testdata"
+	if err := (Gatherer{Name: "netif", Type: "netif", UseHostRoot: true}).Validate(); err != nil {
+		t.Errorf("Validate() of a collector replayed from HostRoot = %v, wanted nil", err)
+	}
+	CommandRunner = ExecRunner{}
+
+	SpoolLayout = LayoutNDJSON
+	defer func() { SpoolLayout = LayoutDocument }()
+	if err := (Gatherer{Name: "netif", Type: "netif"}).Validate(); err == nil {
+		t.Error("Validate() of a collector with the ndjson layout = nil, wanted error")
+	}
+	if err := (Gatherer{Name: "uname", Cmd: []string{"uname"}}).Validate(); err != nil {
+		t.Errorf("Validate() of a command with the ndjson layout = %v, wanted nil", err)
+	}
+}
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// Constants from linux/sockios.h and linux/ethtool.h.
+const (
+	siocEthtool = 0x8946
+
+	ethtoolGDrvInfo   = 0x03
+	ethtoolGRingParam = 0x10
+	ethtoolGRxCsum    = 0x14
+	ethtoolGTxCsum    = 0x16
+	ethtoolGSG        = 0x18
+	ethtoolGTSO       = 0x1e
+	ethtoolGGSO       = 0x23
+	ethtoolGFlags     = 0x25
+	ethtoolGGRO       = 0x2b
+
+	ethFlagLRO = 1 << 15
+)
+
+// ethtoolFeatures are the offloads that have a legacy ethtool getter, named
+// the way `ethtool -k` names them.
+var ethtoolFeatures = []struct {
+	name string
+	cmd  uint32
+	mask uint32
+}{
+	{"rx-checksumming", ethtoolGRxCsum, 0},
+	{"tx-checksumming", ethtoolGTxCsum, 0},
+	{"scatter-gather", ethtoolGSG, 0},
+	{"tcp-segmentation-offload", ethtoolGTSO, 0},
+	{"generic-segmentation-offload", ethtoolGGSO, 0},
+	{"generic-receive-offload", ethtoolGGRO, 0},
+	{"large-receive-offload", ethtoolGFlags, ethFlagLRO},
+}
+
+// ifreq is struct ifreq with its union holding a pointer to the ethtool
+// command.
+type ifreq struct {
+	name [16]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+// ethtoolDrvInfo is struct ethtool_drvinfo.
+type ethtoolDrvInfo struct {
+	cmd         uint32
+	driver      [32]byte
+	version     [32]byte
+	fwVersion   [32]byte
+	busInfo     [32]byte
+	eromVersion [32]byte
+	reserved2   [12]byte
+	nPrivFlags  uint32
+	nStats      uint32
+	testInfoLen uint32
+	eedumpLen   uint32
+	regdumpLen  uint32
+}
+
+// ethtoolRingParam is struct ethtool_ringparam.
+type ethtoolRingParam struct {
+	cmd               uint32
+	rxMaxPending      uint32
+	rxMiniMaxPending  uint32
+	rxJumboMaxPending uint32
+	txMaxPending      uint32
+	rxPending         uint32
+	rxMiniPending     uint32
+	rxJumboPending    uint32
+	txPending         uint32
+}
+
+// ethtoolValue is struct ethtool_value.
+type ethtoolValue struct {
+	cmd  uint32
+	data uint32
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// ethtoolIoctl runs a single ethtool command against the named interface.
+// The first field of data must be the command number.
+func ethtoolIoctl(fd int, name string, data unsafe.Pointer) error {
+	var ifr ifreq
+	if len(name) >= len(ifr.name) {
+		return fmt.Errorf("interface name %q is too long", name)
+	}
+	copy(ifr.name[:], name)
+	ifr.data = data
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ethtool fills in the driver information, ring sizes and offloads of the
+// interface. Only a failure to get the driver information is an error, since
+// many drivers don't support the other commands.
+func ethtool(iface *api.NetInterface) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	drvinfo := ethtoolDrvInfo{cmd: ethtoolGDrvInfo}
+	if err := ethtoolIoctl(fd, iface.Name, unsafe.Pointer(&drvinfo)); err != nil {
+		return fmt.Errorf("ETHTOOL_GDRVINFO: %v", err)
+	}
+	if iface.Driver == "" {
+		iface.Driver = cString(drvinfo.driver[:])
+	}
+	iface.DriverVersion = cString(drvinfo.version[:])
+	iface.FirmwareVersion = cString(drvinfo.fwVersion[:])
+	iface.BusInfo = cString(drvinfo.busInfo[:])
+
+	ring := ethtoolRingParam{cmd: ethtoolGRingParam}
+	if ethtoolIoctl(fd, iface.Name, unsafe.Pointer(&ring)) == nil {
+		iface.RxRing, iface.RxRingMax = int(ring.rxPending), int(ring.rxMaxPending)
+		iface.TxRing, iface.TxRingMax = int(ring.txPending), int(ring.txMaxPending)
+	}
+
+	for _, f := range ethtoolFeatures {
+		value := ethtoolValue{cmd: f.cmd}
+		if ethtoolIoctl(fd, iface.Name, unsafe.Pointer(&value)) != nil {
+			continue
+		}
+		enabled := value.data != 0
+		if f.mask != 0 {
+			enabled = value.data&f.mask != 0
+		}
+		iface.Features = append(iface.Features, api.NetFeature{Name: f.name, Enabled: enabled})
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// filesystemCollector records every mount in /proc/self/mountinfo, or the
+// host's /proc/1/mountinfo with UseHostRoot, with the space and inodes
+// statfs(2) reports for it. Mounts are selected by filesystem type rather than
+// by mount point, so excluding pseudo filesystems like "tmpfs" and "proc"
+// leaves the real disks. A mount that can't be statted is recorded without
+// its usage.
+type filesystemCollector struct{}
+
+func (filesystemCollector) validate(g Gatherer) error {
+	return validatePatterns(g)
+}
+
+// unescapeMountinfo undoes the octal escaping of spaces, tabs, newlines and
+// backslashes in the fields of /proc/self/mountinfo.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// parseMountinfo parses a single line of /proc/self/mountinfo, which looks
+// like
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where the optional fields before the "-" may be absent.
+func parseMountinfo(line string) (api.Filesystem, error) {
+	fields := strings.Fields(line)
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if len(fields) < 6 || sep < 0 || sep+3 > len(fields) {
+		return api.Filesystem{}, fmt.Errorf("malformed mountinfo line %q", line)
+	}
+	return api.Filesystem{
+		MountPoint:   unescapeMountinfo(fields[4]),
+		Options:      fields[5],
+		Type:         fields[sep+1],
+		Source:       unescapeMountinfo(fields[sep+2]),
+		SuperOptions: strings.Join(fields[sep+3:], " "),
+	}, nil
+}
+
+func (filesystemCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	// Our own mount table is the container's, so the host's is read from its
+	// init process instead.
+	mountinfo := "/proc/self/mountinfo"
+	if g.UseHostRoot {
+		mountinfo = "/proc/1/mountinfo"
+	}
+	f, err := os.Open(g.path(mountinfo))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	size := 0
+	byMountPoint := make(map[string]api.Filesystem)
+	for _, fs := range nodeinfo.Filesystems {
+		byMountPoint[fs.MountPoint] = fs
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fs, err := parseMountinfo(scanner.Text())
+		if err != nil {
+			return 0, err
+		}
+		if !selected(g, fs.Type) {
+			continue
+		}
+		// Mounts that can't be reached, e.g. because they are hidden by a
+		// later mount, are recorded without their usage.
+		var st syscall.Statfs_t
+		if syscall.Statfs(g.path(fs.MountPoint), &st) == nil {
+			bsize := uint64(st.Bsize)
+			fs.Size = int64(st.Blocks * bsize)
+			fs.Free = int64(st.Bfree * bsize)
+			fs.Available = int64(st.Bavail * bsize)
+			fs.Inodes = int64(st.Files)
+			fs.InodesFree = int64(st.Ffree)
+		}
+		size += len(fs.MountPoint) + len(fs.Type) + len(fs.Source) + len(fs.Options) + len(fs.SuperOptions)
+		byMountPoint[fs.MountPoint] = fs
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	nodeinfo.Filesystems = nodeinfo.Filesystems[:0]
+	for _, fs := range byMountPoint {
+		nodeinfo.Filesystems = append(nodeinfo.Filesystems, fs)
+	}
+	sort.Slice(nodeinfo.Filesystems, func(i, j int) bool { return nodeinfo.Filesystems[i].MountPoint < nodeinfo.Filesystems[j].MountPoint })
+	return size, nil
+}
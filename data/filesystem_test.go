@@ -0,0 +1,62 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestParseMountinfo(t *testing.T) {
+	fs, err := parseMountinfo(`36 35 98:0 /mnt1 /mnt\0402 rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue`)
+	if err != nil {
+		t.Fatalf("parseMountinfo() = %v, wanted nil", err)
+	}
+	want := api.Filesystem{
+		MountPoint:   "/mnt 2",
+		Type:         "ext3",
+		Source:       "/dev/root",
+		Options:      "rw,noatime",
+		SuperOptions: "rw,errors=continue",
+	}
+	if fs != want {
+		t.Errorf("parseMountinfo() = %#v, wanted %#v", fs, want)
+	}
+	for _, line := range []string{"", "36 35 98:0 /mnt1 /mnt2 rw", "36 35 98:0 /mnt1 /mnt2 rw - ext3"} {
+		if _, err := parseMountinfo(line); err == nil {
+			t.Errorf("parseMountinfo(%q) = nil, wanted an error", line)
+		}
+	}
+}
+
+func TestFilesystemCollector(t *testing.T) {
+	// The usage comes from whatever disk holds the testdata, so only the
+	// mounts are compared in full.
+	nodeinfo := gatherTestdata(t, Gatherer{Name: "filesystem", Type: "filesystem", Exclude: []string{"proc", "tmpfs"}})
+	var mountPoints []string
+	for _, fs := range nodeinfo.Filesystems {
+		mountPoints = append(mountPoints, fs.MountPoint)
+	}
+	// The container's own mounts, like its overlay root, are not the host's.
+	if len(nodeinfo.Filesystems) != 3 {
+		t.Fatalf("Filesystems = %q, wanted /, /missing and /mnt/local disk of the host", mountPoints)
+	}
+	root, missing, local := nodeinfo.Filesystems[0], nodeinfo.Filesystems[1], nodeinfo.Filesystems[2]
+	if root.MountPoint != "/" || root.Type != "ext4" || root.Source != "/dev/sda1" || root.Size == 0 || root.Inodes == 0 {
+		t.Errorf("Filesystems[0] = %#v, wanted / with its usage", root)
+	}
+	if missing.MountPoint != "/missing" || missing.Size != 0 {
+		t.Errorf("Filesystems[1] = %#v, wanted /missing without usage", missing)
+	}
+	if local.MountPoint != "/mnt/local disk" || local.Type != "xfs" || local.SuperOptions != "rw,attr2,inode64,noquota" || local.Size == 0 {
+		t.Errorf("Filesystems[2] = %#v, wanted /mnt/local disk with its usage", local)
+	}
+}
+
+func TestFilesystemCollectorMissing(t *testing.T) {
+	HostRoot = t.TempDir()
+	defer func() { HostRoot = "" }()
+	g := Gatherer{Name: "filesystem", Type: "filesystem", UseHostRoot: true}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error for a missing mountinfo")
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// Limits on the number of commands a ForEach gatherer expands into.
+const (
+	DefaultMaxItems = 64
+	MaxMaxItems     = 1024
+)
+
+// ForEach makes a gatherer run its Cmd once per item of an enumeration, e.g.
+// once per network interface with
+//
+//	"Cmd": ["ethtool", "-i", "{{.Item}}"],
+//	"ForEach": {"Glob": "/sys/class/net/*"}
+//
+// Every argument of Cmd is a text/template executed with the fields of
+// ForEachItem.
+type ForEach struct {
+	// Glob enumerates the files matching the pattern, sorted by path.
+	Glob string `json:",omitempty"`
+	// Cmd enumerates the non-empty lines of the command's output.
+	Cmd []string `json:",omitempty"`
+	// MaxItems limits how many commands are run. Items beyond the limit are
+	// skipped. It defaults to DefaultMaxItems.
+	MaxItems int `json:",omitempty"`
+}
+
+// ForEachItem is what the Cmd template of a ForEach gatherer is executed
+// with.
+type ForEachItem struct {
+	// Item is the base name of a matching file, or a line of output.
+	Item string
+	// Path is the full path of a matching file, or empty for lines of output.
+	Path string
+}
+
+// validate checks the enumeration and the templates in cmd.
+func (f ForEach) validate(cmd []string) error {
+	if (f.Glob == "") == (len(f.Cmd) == 0) {
+		return errors.New("ForEach needs exactly one of Glob and Cmd")
+	}
+	if f.Glob != "" {
+		if _, err := filepath.Match(f.Glob, ""); err != nil {
+			return err
+		}
+	}
+	if f.MaxItems < 0 || f.MaxItems > MaxMaxItems {
+		return fmt.Errorf("ForEach MaxItems %d is not between 0 and %d", f.MaxItems, MaxMaxItems)
+	}
+	if len(cmd) == 0 {
+		return errors.New("gatherer has no command")
+	}
+	for _, arg := range cmd {
+		if _, err := parseArg(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseArg(arg string) (*template.Template, error) {
+	return template.New("arg").Option("missingkey=error").Parse(arg)
+}
+
+// items returns the items the gatherer expands into, up to the limit.
+func (f ForEach) items(g Gatherer) ([]ForEachItem, error) {
+	var items []ForEachItem
+	if f.Glob != "" {
+		pattern := f.Glob
+		if g.UseHostRoot {
+			pattern = hostPath(pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			// Paths are recorded as they are on the host.
+			p := m
+			if g.UseHostRoot && HostRoot != "" {
+				p, _ = filepath.Rel(HostRoot, m)
+				p = "/" + p
+			}
+			items = append(items, ForEachItem{Item: filepath.Base(m), Path: p})
+		}
+	} else {
+		helper := Gatherer{Name: g.Name + ".items", Cmd: f.Cmd, UseHostRoot: g.UseHostRoot}
+		out, err := g.runHelper(helper.withHostRoot())
+		if err != nil {
+			return nil, fmt.Errorf("failed to enumerate items (error: %v)", err)
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				items = append(items, ForEachItem{Item: line})
+			}
+		}
+	}
+	max := f.MaxItems
+	if max == 0 {
+		max = DefaultMaxItems
+	}
+	if len(items) > max {
+		log.Printf("%v expands into %d items, only running the first %d\n", g.Name, len(items), max)
+		items = items[:max]
+	}
+	return items, nil
+}
+
+// expand returns the command of the gatherer for a single item.
+func expand(cmd []string, item ForEachItem) ([]string, error) {
+	var expanded []string
+	for _, arg := range cmd {
+		t, err := parseArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := t.Execute(&sb, item); err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, sb.String())
+	}
+	return expanded, nil
+}
+
+// gatherEach runs the command once per item and records every output. A
+// failing item doesn't stop the others, but the gatherer still fails once
+// they have all run.
+func (g Gatherer) gatherEach(nodeinfo *api.NodeInfoV1) int {
+	items, err := g.ForEach.items(g)
+	if err != nil {
+		log.Panicf("failed to run %v (error: %v)", g.Name, err)
+	}
+	size := 0
+	var failures []string
+	for i := range items {
+		expanded := g
+		if expanded.Cmd, err = expand(g.Cmd, items[i]); err == nil {
+			var n int
+			n, err = expanded.run(&items[i], nodeinfo)
+			size += n
+		}
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		log.Panicf("%d of %d items failed: %v", len(failures), len(items), strings.Join(failures, "; "))
+	}
+	return size
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestForEachGlob(t *testing.T) {
+	HostRoot = "../testdata"
+	defer func() { HostRoot = "" }()
+	g := Gatherer{
+		Name:        "mtu",
+		Cmd:         []string{"cat", "{{.Path}}/mtu"},
+		ForEach:     &ForEach{Glob: "/sys/class/net/*"},
+		UseHostRoot: true,
+	}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, wanted nil", err)
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	want := []api.CmdOut{
+		{Name: "mtu", CommandLine: "cat /sys/class/net/dummy9/mtu", Output: "1500", Item: "dummy9"},
+		{Name: "mtu", CommandLine: "cat /sys/class/net/eth0/mtu", Output: "1500", Item: "eth0"},
+		{Name: "mtu", CommandLine: "cat /sys/class/net/lo/mtu", Output: "65536", Item: "lo"},
+	}
+	if got := withoutUsage(nodeinfo.Commands); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands = %#v, wanted %#v", got, want)
+	}
+}
+
+func TestForEachCmd(t *testing.T) {
+	g := Gatherer{
+		Name:    "echo",
+		Cmd:     []string{"echo", "item", "{{.Item}}"},
+		ForEach: &ForEach{Cmd: []string{"printf", "a\\n b \\n\\nc\\n"}, MaxItems: 2},
+	}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, wanted nil", err)
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	want := []api.CmdOut{
+		{Name: "echo", CommandLine: "echo item a", Output: "item a", Item: "a"},
+		{Name: "echo", CommandLine: "echo item b", Output: "item b", Item: "b"},
+	}
+	if got := withoutUsage(nodeinfo.Commands); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands = %#v, wanted %#v", got, want)
+	}
+}
+
+func TestForEachFailures(t *testing.T) {
+	g := Gatherer{
+		Name:    "picky",
+		Cmd:     []string{"sh", "-c", "test {{.Item}} != b && echo {{.Item}}"},
+		ForEach: &ForEach{Cmd: []string{"printf", "a\\nb\\nc\\n"}},
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error for item b")
+	}
+	// The items that succeeded are still recorded.
+	var items []string
+	for _, cmd := range nodeinfo.Commands {
+		items = append(items, cmd.Item)
+	}
+	if !reflect.DeepEqual(items, []string{"a", "c"}) {
+		t.Errorf("Commands were run for %q, wanted a and c", items)
+	}
+
+	g = Gatherer{Name: "broken", Cmd: []string{"echo"}, ForEach: &ForEach{Cmd: []string{"false"}}}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error from a failing enumeration")
+	}
+}
+
+func TestForEachRedactsItems(t *testing.T) {
+	g := Gatherer{
+		Name:       "neigh",
+		Cmd:        []string{"echo", "lladdr", "{{.Item}}"},
+		ForEach:    &ForEach{Cmd: []string{"printf", "token=s3cret\\n"}},
+		Redactions: []Redaction{{Action: RedactReplace, Pattern: "s3cret", Replacement: "XXX"}},
+	}
+	// The secret is in the item, so it is also in the expanded command line.
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	want := []api.CmdOut{{Name: "neigh", CommandLine: "echo lladdr token=XXX", Output: "lladdr token=XXX", Item: "token=XXX"}}
+	if got := withoutUsage(nodeinfo.Commands); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands = %#v, wanted %#v", got, want)
+	}
+}
+
+func TestForEachReplay(t *testing.T) {
+	defer func() { CommandRunner = ExecRunner{} }()
+	dir := t.TempDir()
+	g := Gatherer{
+		Name:    "echo",
+		Cmd:     []string{"echo", "{{.Item}}"},
+		ForEach: &ForEach{Cmd: []string{"printf", "a/b\\nc\\n"}},
+	}
+	CommandRunner = RecordingRunner{Runner: ExecRunner{}, Dir: dir}
+	recorded := &api.NodeInfoV1{}
+	if r := g.Gather(false, recorded); r.Err != nil {
+		t.Fatalf("Gather() while recording = %v, wanted nil", r.Err)
+	}
+	CommandRunner = ReplayRunner{Dir: dir}
+	replayed := &api.NodeInfoV1{}
+	if r := g.Gather(false, replayed); r.Err != nil {
+		t.Fatalf("Gather() while replaying = %v, wanted nil", r.Err)
+	}
+	recorded.Commands = withoutUsage(recorded.Commands)
+	if !reflect.DeepEqual(recorded, replayed) || len(replayed.Commands) != 2 {
+		t.Errorf("replayed %#v, wanted %#v", replayed, recorded)
+	}
+}
+
+func TestForEachValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		g    Gatherer
+	}{
+		{"no enumeration", Gatherer{Name: "x", Cmd: []string{"echo"}, ForEach: &ForEach{}}},
+		{"two enumerations", Gatherer{Name: "x", Cmd: []string{"echo"}, ForEach: &ForEach{Glob: "/*", Cmd: []string{"ls"}}}},
+		{"bad glob", Gatherer{Name: "x", Cmd: []string{"echo"}, ForEach: &ForEach{Glob: "/["}}},
+		{"bad template", Gatherer{Name: "x", Cmd: []string{"echo", "{{.Item"}, ForEach: &ForEach{Glob: "/*"}}},
+		{"too many items", Gatherer{Name: "x", Cmd: []string{"echo"}, ForEach: &ForEach{Glob: "/*", MaxItems: MaxMaxItems + 1}}},
+		{"no command", Gatherer{Name: "x", ForEach: &ForEach{Glob: "/*"}}},
+	}
+	for _, tt := range tests {
+		if err := tt.g.Validate(); err == nil {
+			t.Errorf("%v: Validate() = nil, wanted an error", tt.name)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	got, err := expand([]string{"ethtool", "-i", "{{.Item}}", "{{.Path}}"}, ForEachItem{Item: "eth0", Path: "/sys/class/net/eth0"})
+	if err != nil || !reflect.DeepEqual(got, []string{"ethtool", "-i", "eth0", "/sys/class/net/eth0"}) {
+		t.Errorf("expand() = %q, %v", got, err)
+	}
+	if _, err := expand([]string{"{{.Missing}}"}, ForEachItem{}); err == nil {
+		t.Error("expand() = nil, wanted an error for an unknown field")
+	}
+}
@@ -3,33 +3,99 @@
 package data
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/m-lab/nodeinfo/api"
 	"github.com/m-lab/nodeinfo/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Supported compression formats for saved files.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Compressions lists every supported compression format.
+var Compressions = []string{CompressionNone, CompressionGzip, CompressionZstd}
+
+// Supported layouts for saved files. The document layout saves one
+// api.NodeInfoV1 per file, and the NDJSON layout saves one api.CmdRowV1 per
+// line. The NDJSON layout only has rows for commands, so it does not save the
+// structured records of built-in collectors.
+const (
+	LayoutDocument = "document"
+	LayoutNDJSON   = "ndjson"
+)
+
+// Layouts lists every supported layout.
+var Layouts = []string{LayoutDocument, LayoutNDJSON}
+
+// SpoolLayout is the layout of the spool sink. Built-in collectors are refused
+// while it is LayoutNDJSON, as their records would not be saved.
+var SpoolLayout = LayoutDocument
+
 // Gatherer holds all the information needed about a single data-producing command.
 type Gatherer struct {
-	Name string
-	Cmd  []string
+	Name       string
+	Cmd        []string
+	Redactions []Redaction `json:",omitempty"`
+	Namespaces *Namespaces `json:",omitempty"`
+	Limits     *Limits     `json:",omitempty"`
+
+	// UseHostRoot resolves absolute path arguments under HostRoot.
+	UseHostRoot bool `json:",omitempty"`
+
+	// ForEach runs Cmd once per item of an enumeration.
+	ForEach *ForEach `json:",omitempty"`
+
+	// Type selects a built-in collector instead of running Cmd. Include and
+	// Exclude are glob patterns selecting what some collectors record.
+	Type    string   `json:",omitempty"`
+	Include []string `json:",omitempty"`
+	Exclude []string `json:",omitempty"`
+
+	// Ethtool makes the netif collector also query drivers through ethtool.
+	Ethtool bool `json:",omitempty"`
+
+	// logicalCmd is Cmd before withHostRoot resolved its paths.
+	logicalCmd []string
+}
+
+// Result describes a single run of a gatherer.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Bytes    int   // Length of the recorded output.
+	Err      error // Why the gatherer failed, or nil if it succeeded.
 }
 
 // Gather runs the command and gathers the data into the file in the directory.
-func (g Gatherer) Gather(crashOnError bool, nodeinfo *api.NodeInfoV1) {
+// Unless crashOnError is set, failures are recovered from and reported in the
+// returned Result.
+func (g Gatherer) Gather(crashOnError bool, nodeinfo *api.NodeInfoV1) (result Result) {
+	result.Name = g.Name
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
 	// Optionally recover from errors.
 	if !crashOnError {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("failed to run %v (error: %q)\n", g, r)
 				metrics.GatherErrors.WithLabelValues(g.Name).Inc()
+				result.Err = fmt.Errorf("%v", r)
 			}
 		}()
 	}
@@ -40,41 +106,189 @@ func (g Gatherer) Gather(crashOnError bool, nodeinfo *api.NodeInfoV1) {
 	defer timer.ObserveDuration()
 
 	// Run the command.
-	g.gather(nodeinfo)
+	result.Bytes = g.gather(nodeinfo)
+	return result
+}
+
+// SaveResult describes a file written by Save.
+type SaveResult struct {
+	Filename         string
+	Size             int64 // Bytes written to disk.
+	UncompressedSize int64 // Bytes of marshalled JSON before compression.
 }
 
-// Save marshals the gathered data, writes it to a file, and returns
-// the filename and/or error (if any).
-func Save(datadir, datatype string, nodeinfo api.NodeInfoV1) (string, error) {
-	b, err := json.Marshal(nodeinfo)
+// Save marshals the gathered data in the given layout, compresses it, writes
+// it to a file, and returns a description of the file and/or error (if any).
+func Save(datadir, datatype, layout, compression string, nodeinfo api.NodeInfoV1) (SaveResult, error) {
+	nowUTC := time.Now().UTC()
+	b, err := marshal(layout, nowUTC, nodeinfo)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal data (error: %v)", err)
+		return SaveResult{}, fmt.Errorf("failed to marshal data (error: %v)", err)
+	}
+	return write(datadir, datatype, compression, nowUTC, b)
+}
+
+// SaveChanges writes change records to a file in the document layout, the
+// same way Save does, and returns a description of the file and/or error (if
+// any).
+func SaveChanges(datadir, datatype, compression string, changes api.NodeInfoChangeV1) (SaveResult, error) {
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return SaveResult{}, fmt.Errorf("failed to marshal changes (error: %v)", err)
+	}
+	return write(datadir, datatype, compression, time.Now().UTC(), b)
+}
+
+// write compresses marshalled data and writes it to a new file named after the
+// passed-in time in the datatype directory.
+func write(datadir, datatype, compression string, nowUTC time.Time, b []byte) (SaveResult, error) {
+	result := SaveResult{UncompressedSize: int64(len(b))}
+	b, ext, err := compress(compression, b)
+	if err != nil {
+		return result, fmt.Errorf("failed to compress data (error: %v)", err)
 	}
-	nowUTC := time.Now().UTC()
 	dir := fmt.Sprintf("%s/%s/%s", datadir, datatype, nowUTC.Format("2006/01/02"))
 	if err := os.MkdirAll(dir, 0o775); err != nil {
-		return "", fmt.Errorf("failed to create directory (error: %v)", err)
+		return result, fmt.Errorf("failed to create directory (error: %v)", err)
+	}
+	result.Filename = fmt.Sprintf("%s/%s%s", dir, nowUTC.Format("20060102T150405.000000Z"), ext)
+	log.Print(result.Filename)
+	if err := os.WriteFile(result.Filename, b, 0o666); err != nil {
+		return result, fmt.Errorf("failed to write file (error: %v)", err)
+	}
+	result.Size = int64(len(b))
+	return result, nil
+}
+
+// marshal returns the data in the named layout. Rows of the NDJSON layout are
+// stamped with the passed-in run time.
+func marshal(layout string, runTime time.Time, nodeinfo api.NodeInfoV1) ([]byte, error) {
+	switch layout {
+	case "", LayoutDocument:
+		return json.Marshal(nodeinfo)
+	case LayoutNDJSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for i, cmd := range nodeinfo.Commands {
+			row := api.CmdRowV1{
+				RunTime:     runTime,
+				Index:       i,
+				Name:        cmd.Name,
+				CommandLine: cmd.CommandLine,
+				Output:      cmd.Output,
+				Namespaces:  cmd.Namespaces,
+				Item:        cmd.Item,
+				Limits:      cmd.Limits,
+				Usage:       cmd.Usage,
+			}
+			if err := enc.Encode(row); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown layout %q", layout)
+}
+
+// compress returns the data compressed with the named compression format,
+// along with the file extension that should be used for it.
+func compress(compression string, b []byte) ([]byte, string, error) {
+	switch compression {
+	case "", CompressionNone:
+		return b, ".json", nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".json.gz", nil
+	case CompressionZstd:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, "", err
+		}
+		defer w.Close()
+		return w.EncodeAll(b, nil), ".json.zst", nil
+	}
+	return nil, "", fmt.Errorf("unknown compression %q", compression)
+}
+
+// gather runs the command and returns the length of its recorded output.
+// Gather sets up all monitoring, metrics, and recovery code, and then gather()
+// does the work.
+func (g Gatherer) gather(nodeinfo *api.NodeInfoV1) int {
+	if g.Type != "" {
+		return g.collect(nodeinfo)
+	}
+	if g.ForEach != nil {
+		return g.gatherEach(nodeinfo)
 	}
-	file := fmt.Sprintf("%s/%s.json", dir, nowUTC.Format("20060102T150405.000000Z"))
-	log.Print(file)
-	if err := os.WriteFile(file, b, 0o666); err != nil {
-		return file, fmt.Errorf("failed to write file (error: %v)", err)
+	size, err := g.run(nil, nodeinfo)
+	if err != nil {
+		log.Panic(err)
 	}
-	return file, nil
+	return size
 }
 
-// gather runs the command. Gather sets up all monitoring, metrics, and
-// recovery code, and then gather() does the work.
-func (g Gatherer) gather(nodeinfo *api.NodeInfoV1) {
+// run runs the command of the gatherer, expanded for the item of a ForEach
+// gatherer if there is one, and records its output.
+func (g Gatherer) run(item *ForEachItem, nodeinfo *api.NodeInfoV1) (int, error) {
+	// The items of a ForEach gatherer come from the node like its output, and
+	// so are redacted along with the command lines they are expanded into.
 	cmd := api.CmdOut{
 		Name:        g.Name,
-		CommandLine: strings.Join(g.Cmd, " "),
+		CommandLine: g.redact(strings.Join(g.Cmd, " ")),
+		Limits:      g.Limits.String(),
 	}
 	log.Printf("   %v\n", cmd.CommandLine)
-	out, err := exec.Command(g.Cmd[0], g.Cmd[1:]...).Output()
+	// The command line records the logical paths, so the data is comparable
+	// between containerized and bare-metal runs.
+	run := g.withHostRoot()
+	if item != nil {
+		cmd.Item = g.redact(item.Item)
+		run.Name = fmt.Sprintf("%s[%s]", g.Name, item.Item)
+	}
+	var out []byte
+	var err error
+	if g.Namespaces != nil {
+		out, cmd.Usage, cmd.Namespaces, err = g.Namespaces.run(CommandRunner, run)
+	} else {
+		out, cmd.Usage, err = CommandRunner.Run(run)
+	}
+	if cmd.Usage != nil {
+		observeUsage(g.Name, cmd.Usage)
+	}
 	if err != nil {
-		log.Panicf("failed to run %v (error: %v)", cmd.CommandLine, err)
+		return 0, fmt.Errorf("failed to run %v (error: %v)", cmd.CommandLine, err)
 	}
-	cmd.Output = strings.TrimSuffix(string(out), "\n")
+	cmd.Output = g.redact(strings.TrimSuffix(string(out), "\n"))
 	nodeinfo.Commands = append(nodeinfo.Commands, cmd)
+	return len(cmd.Output), nil
+}
+
+// runHelper runs a command the gatherer needs besides its own, like the
+// enumeration of a ForEach gatherer, in the same namespaces and with the same
+// limits.
+func (g Gatherer) runHelper(helper Gatherer) ([]byte, error) {
+	helper.Namespaces = g.Namespaces
+	helper.Limits = g.Limits
+	if g.Namespaces != nil {
+		out, _, _, err := g.Namespaces.run(CommandRunner, helper)
+		return out, err
+	}
+	out, _, err := CommandRunner.Run(helper)
+	return out, err
+}
+
+// observeUsage exports the resources used by a command of the gatherer.
+func observeUsage(name string, u *api.Usage) {
+	metrics.GatherCPUTime.WithLabelValues(name, "user").Observe(u.UserSeconds)
+	metrics.GatherCPUTime.WithLabelValues(name, "system").Observe(u.SystemSeconds)
+	metrics.GatherMaxRSS.WithLabelValues(name).Observe(float64(u.MaxRSS))
+	metrics.GatherBlockOperations.WithLabelValues(name, "in").Observe(float64(u.InBlocks))
+	metrics.GatherBlockOperations.WithLabelValues(name, "out").Observe(float64(u.OutBlocks))
 }
@@ -1,10 +1,16 @@
 package data
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/m-lab/go/rtx"
 	"github.com/m-lab/nodeinfo/api"
 )
@@ -82,15 +88,150 @@ func TestSave(t *testing.T) {
 		},
 	}
 	want := `{"commands":[{"Name":"name1","CommandLine":"cmdLine1","Output":"output1 line 1\noutput2 line 2"},{"Name":"name2","CommandLine":"cmdLine2","Output":"output1 line 1\noutput2 line 2"}]}`
-	file, err := Save(dir, "nodeinfo1", nodeinfo1)
+	result, err := Save(dir, "nodeinfo1", LayoutDocument, CompressionNone, nodeinfo1)
 	if err != nil {
 		t.Errorf("Save() = %v, wanted nil", err)
 	}
-	got, err := os.ReadFile(file)
+	got, err := os.ReadFile(result.Filename)
 	if err != nil {
 		t.Errorf("os.ReadFile() = %v, wanted nil", err)
 	}
 	if string(got) != want {
 		t.Errorf("os.ReadFile() = %v, wanted %v", got, want)
 	}
+	if result.Size != int64(len(want)) || result.UncompressedSize != int64(len(want)) {
+		t.Errorf("Save() = %#v, wanted sizes of %d", result, len(want))
+	}
+}
+
+func TestSaveCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSaveCompressed")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	nodeinfo1 := api.NodeInfoV1{
+		Commands: []api.CmdOut{
+			{
+				Name:        "lshw",
+				CommandLine: "lshw",
+				Output:      strings.Repeat("a very repetitive line of output\n", 100),
+			},
+		},
+	}
+	tests := []struct {
+		compression string
+		ext         string
+		reader      func(io.Reader) (io.Reader, error)
+	}{
+		{
+			compression: CompressionNone,
+			ext:         ".json",
+			reader:      func(r io.Reader) (io.Reader, error) { return r, nil },
+		},
+		{
+			compression: CompressionGzip,
+			ext:         ".json.gz",
+			reader:      func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			compression: CompressionZstd,
+			ext:         ".json.zst",
+			reader:      func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			result, err := Save(dir, "nodeinfo1", LayoutDocument, tt.compression, nodeinfo1)
+			if err != nil {
+				t.Fatalf("Save() = %v, wanted nil", err)
+			}
+			if !strings.HasSuffix(result.Filename, tt.ext) {
+				t.Errorf("Save() filename = %q, wanted extension %q", result.Filename, tt.ext)
+			}
+			if tt.compression != CompressionNone && result.Size >= result.UncompressedSize {
+				t.Errorf("Save() size = %d, wanted less than %d", result.Size, result.UncompressedSize)
+			}
+			f, err := os.Open(result.Filename)
+			rtx.Must(err, "failed to open saved file")
+			defer f.Close()
+			info, err := f.Stat()
+			rtx.Must(err, "failed to stat saved file")
+			if info.Size() != result.Size {
+				t.Errorf("file size = %d, wanted %d", info.Size(), result.Size)
+			}
+			r, err := tt.reader(f)
+			rtx.Must(err, "failed to create decompressor")
+			var got api.NodeInfoV1
+			if err := json.NewDecoder(r).Decode(&got); err != nil {
+				t.Fatalf("Decode() = %v, wanted nil", err)
+			}
+			if !reflect.DeepEqual(got, nodeinfo1) {
+				t.Errorf("Decode() = %#v, wanted %#v", got, nodeinfo1)
+			}
+		})
+	}
+}
+
+func TestSaveUnknownCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSaveUnknownCompression")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	if _, err := Save(dir, "nodeinfo1", LayoutDocument, "lzma", api.NodeInfoV1{}); err == nil {
+		t.Error("Save() = nil, wanted error")
+	}
+}
+
+func TestSaveNDJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSaveNDJSON")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	nodeinfo1 := api.NodeInfoV1{
+		Commands: []api.CmdOut{
+			{Name: "name1", CommandLine: "cmdLine1", Output: "output1"},
+			{Name: "name2", CommandLine: "cmdLine2", Output: "output2"},
+		},
+	}
+	result, err := Save(dir, "nodeinforow1", LayoutNDJSON, CompressionNone, nodeinfo1)
+	rtx.Must(err, "failed to save")
+	f, err := os.Open(result.Filename)
+	rtx.Must(err, "failed to open saved file")
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	var rows []api.CmdRowV1
+	for dec.More() {
+		var row api.CmdRowV1
+		rtx.Must(dec.Decode(&row), "failed to decode row")
+		rows = append(rows, row)
+	}
+	if len(rows) != len(nodeinfo1.Commands) {
+		t.Fatalf("rows = %d, wanted %d", len(rows), len(nodeinfo1.Commands))
+	}
+	for i, row := range rows {
+		cmd := nodeinfo1.Commands[i]
+		if row.Index != i || row.Name != cmd.Name || row.CommandLine != cmd.CommandLine || row.Output != cmd.Output {
+			t.Errorf("row %d = %#v, wanted fields of %#v", i, row, cmd)
+		}
+		if !row.RunTime.Equal(rows[0].RunTime) || row.RunTime.IsZero() {
+			t.Errorf("row %d RunTime = %v, wanted a single non-zero run time", i, row.RunTime)
+		}
+	}
+
+	if _, err := Save(dir, "nodeinfo1", "xml", CompressionNone, nodeinfo1); err == nil {
+		t.Error("Save() = nil, wanted error")
+	}
+}
+
+func TestGatherResult(t *testing.T) {
+	nodeinfo := &api.NodeInfoV1{}
+	ok := Gatherer{Name: "echo", Cmd: []string{"echo", "hello"}}.Gather(false, nodeinfo)
+	if ok.Name != "echo" || ok.Err != nil || ok.Bytes != len("hello") || ok.Duration <= 0 {
+		t.Errorf("Gather() = %#v, wanted a successful result with 5 bytes", ok)
+	}
+	failed := Gatherer{Name: "false", Cmd: []string{"false"}}.Gather(false, nodeinfo)
+	if failed.Name != "false" || failed.Err == nil || failed.Bytes != 0 {
+		t.Errorf("Gather() = %#v, wanted a failed result", failed)
+	}
+	if len(nodeinfo.Commands) != 1 {
+		t.Errorf("len(nodeinfo.Commands) = %v, expected 1", len(nodeinfo.Commands))
+	}
 }
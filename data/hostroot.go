@@ -0,0 +1,82 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HostRoot is where the host's root filesystem is mounted, e.g. /host when
+// nodeinfo runs in a pod. Gatherers that opt in with UseHostRoot read files
+// under it instead of from the container's root filesystem.
+var HostRoot string
+
+// maxSymlinks bounds how many symbolic links hostPath follows, as the kernel
+// does, so that a loop of links can't hang it.
+const maxSymlinks = 40
+
+// hostPath returns the path under HostRoot that corresponds to an absolute
+// path on the host, or the path itself if HostRoot is not set. Symbolic links
+// are resolved the way the host would resolve them, so that neither absolute
+// links nor ".." can lead outside of HostRoot. A path with more than
+// maxSymlinks links resolves to "", which can't be opened.
+func hostPath(path string) string {
+	if HostRoot == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	resolved := "/"
+	rest := strings.Split(path, "/")
+	links := 0
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			// The parent of the host's root is the root itself.
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		target, err := os.Readlink(filepath.Join(HostRoot, next))
+		if err != nil {
+			// It is not a link, or doesn't exist and so can't be opened.
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return ""
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(HostRoot, resolved)
+}
+
+// withHostRoot returns a copy of the gatherer whose absolute path arguments,
+// including the values of options like --file=/etc/os-release, are resolved
+// under HostRoot. The command itself still runs from the container, so that it
+// need not exist on the host.
+func (g Gatherer) withHostRoot() Gatherer {
+	if !g.UseHostRoot || HostRoot == "" {
+		return g
+	}
+	cmd := []string{g.Cmd[0]}
+	for _, arg := range g.Cmd[1:] {
+		switch {
+		case strings.HasPrefix(arg, "/"):
+			arg = hostPath(arg)
+		case strings.HasPrefix(arg, "-"):
+			if opt, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(value, "/") {
+				arg = opt + "=" + hostPath(value)
+			}
+		}
+		cmd = append(cmd, arg)
+	}
+	g.logicalCmd = g.Cmd
+	g.Cmd = cmd
+	return g
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestWithHostRoot(t *testing.T) {
+	defer func() { HostRoot = "" }()
+	g := Gatherer{Name: "osrelease", Cmd: []string{"/bin/cat", "/etc/os-release", "relative", "--file=/etc/hosts", "-x=y"}, UseHostRoot: true}
+
+	if got := g.withHostRoot(); !reflect.DeepEqual(got.Cmd, g.Cmd) {
+		t.Errorf("withHostRoot() without HostRoot = %q, wanted %q", got.Cmd, g.Cmd)
+	}
+	HostRoot = "/host"
+	want := []string{"/bin/cat", "/host/etc/os-release", "relative", "--file=/host/etc/hosts", "-x=y"}
+	if got := g.withHostRoot(); !reflect.DeepEqual(got.Cmd, want) {
+		t.Errorf("withHostRoot() = %q, wanted %q", got.Cmd, want)
+	}
+	if g.Cmd[1] != "/etc/os-release" {
+		t.Errorf("withHostRoot() modified the original gatherer: %q", g.Cmd)
+	}
+	g.UseHostRoot = false
+	if got := g.withHostRoot(); !reflect.DeepEqual(got.Cmd, g.Cmd) {
+		t.Errorf("withHostRoot() without opting in = %q, wanted %q", got.Cmd, g.Cmd)
+	}
+}
+
+func TestHostPathStaysUnderHostRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestHostPathStaysUnderHostRoot")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	rtx.Must(os.MkdirAll(dir+"/etc", 0o775), "failed to create etc")
+	rtx.Must(os.MkdirAll(dir+"/usr/lib", 0o775), "failed to create usr/lib")
+	rtx.Must(os.Symlink("../usr/lib/os-release", dir+"/etc/os-release"), "failed to link os-release")
+	rtx.Must(os.Symlink("/etc/shadow", dir+"/etc/escape"), "failed to link escape")
+	rtx.Must(os.Symlink("../../../../../..", dir+"/etc/up"), "failed to link up")
+	rtx.Must(os.Symlink("loop", dir+"/etc/loop"), "failed to link loop")
+	HostRoot = dir
+	defer func() { HostRoot = "" }()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/etc/os-release", want: dir + "/usr/lib/os-release"},
+		{path: "/etc/escape", want: dir + "/etc/shadow"},
+		{path: "/etc/up/etc/passwd", want: dir + "/etc/passwd"},
+		{path: "/../../etc/passwd", want: dir + "/etc/passwd"},
+		{path: "/etc/missing/../hosts", want: dir + "/etc/hosts"},
+		{path: "/etc/loop", want: ""},
+		{path: "relative", want: "relative"},
+	}
+	for _, tt := range tests {
+		if got := hostPath(tt.path); got != tt.want {
+			t.Errorf("hostPath(%q) = %q, wanted %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGatherWithHostRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGatherWithHostRoot")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	rtx.Must(os.MkdirAll(dir+"/etc", 0o775), "failed to create etc")
+	rtx.Must(ioutil.WriteFile(dir+"/etc/os-release", []byte("ID=hostos\n"), 0o666), "failed to write os-release")
+	HostRoot = dir
+	defer func() { HostRoot = "" }()
+
+	nodeinfo := &api.NodeInfoV1{}
+	g := Gatherer{Name: "osrelease", Cmd: []string{"cat", "/etc/os-release"}, UseHostRoot: true}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	cmd := nodeinfo.Commands[0]
+	if cmd.Output != "ID=hostos" || cmd.CommandLine != "cat /etc/os-release" {
+		t.Errorf("Gather() = %#v, wanted the host's file with the logical command line", cmd)
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// kubernetesCollector records the pod that nodeinfo runs in, so that the data
+// can be tied to a deployment. The pod is described by the environment
+// variables and files of the Kubernetes downward API, as in
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom:
+//	    fieldRef:
+//	      fieldPath: metadata.name
+//	volumeMounts:
+//	- name: podinfo
+//	  mountPath: /etc/podinfo
+//
+// and by the cgroup of the process. Nothing is an error outside of
+// Kubernetes; the record is just mostly empty. The gatherer's Include and
+// Exclude glob patterns select labels and annotations by key.
+type kubernetesCollector struct{}
+
+func (kubernetesCollector) validate(g Gatherer) error {
+	return validatePatterns(g)
+}
+
+// Where the kubernetes collector looks for the downward API files and the
+// cgroup of the process. These describe the container nodeinfo runs in, so
+// they are never resolved under HostRoot.
+var (
+	podInfoDir = "/etc/podinfo"
+	selfCgroup = "/proc/self/cgroup"
+)
+
+// Environment variables the kubernetes collector reads.
+const (
+	envPodName      = "POD_NAME"
+	envPodNamespace = "POD_NAMESPACE"
+	envPodUID       = "POD_UID"
+	envPodIP        = "POD_IP"
+	envNodeName     = "NODE_NAME"
+)
+
+// revisionLabels are the labels controllers put on their pods to identify the
+// revision of the pod template, in order of preference.
+var revisionLabels = []string{"controller-revision-hash", "pod-template-hash"}
+
+// containerScope matches the last element of the cgroup path of a container,
+// e.g. "cri-containerd-<id>.scope", "crio-<id>.scope", "docker-<id>.scope" or
+// just "<id>" with the cgroupfs driver.
+var containerScope = regexp.MustCompile(`^(?:([a-z-]+?)-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// parseDownwardAPI parses a labels or annotations file of the downward API,
+// which has one key="value" line per entry. A missing file has no entries.
+func parseDownwardAPI(filename string) ([]api.KeyValue, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []api.KeyValue
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		key, quoted, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed line %q in %v", scanner.Text(), filename)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("malformed value %q in %v", quoted, filename)
+		}
+		entries = append(entries, api.KeyValue{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, scanner.Err()
+}
+
+// parseCgroup returns the cgroup path of the process from the contents of
+// /proc/<pid>/cgroup, preferring the unified cgroup v2 hierarchy and
+// otherwise taking the first hierarchy that isn't the root.
+func parseCgroup(contents string) string {
+	var first string
+	for _, line := range strings.Split(contents, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || parts[2] == "/" {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		if first == "" {
+			first = parts[2]
+		}
+	}
+	return first
+}
+
+// parseContainer returns the runtime and container ID in a cgroup path, or
+// empty strings if the path isn't that of a container.
+func parseContainer(cgroup string) (runtime, id string) {
+	m := containerScope.FindStringSubmatch(filepath.Base(cgroup))
+	if m == nil {
+		return "", ""
+	}
+	runtime = strings.TrimPrefix(m[1], "cri-")
+	if runtime == "" && strings.Contains(cgroup, "/docker/") {
+		runtime = "docker"
+	}
+	return runtime, m[2]
+}
+
+func (kubernetesCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	k := &api.Kubernetes{
+		PodName:   os.Getenv(envPodName),
+		Namespace: os.Getenv(envPodNamespace),
+		PodUID:    os.Getenv(envPodUID),
+		PodIP:     os.Getenv(envPodIP),
+		NodeName:  os.Getenv(envNodeName),
+	}
+	labels, err := parseDownwardAPI(filepath.Join(podInfoDir, "labels"))
+	if err != nil {
+		return 0, err
+	}
+	annotations, err := parseDownwardAPI(filepath.Join(podInfoDir, "annotations"))
+	if err != nil {
+		return 0, err
+	}
+	// The revision is recorded before the labels are filtered, so that it is
+	// always there to tie the data to a deployment.
+	for _, name := range revisionLabels {
+		for _, l := range labels {
+			if k.Revision == "" && l.Key == name {
+				k.Revision = l.Value
+			}
+		}
+	}
+	for _, l := range labels {
+		if selected(g, l.Key) {
+			k.Labels = append(k.Labels, l)
+		}
+	}
+	for _, a := range annotations {
+		if selected(g, a.Key) {
+			k.Annotations = append(k.Annotations, a)
+		}
+	}
+
+	b, err := os.ReadFile(selfCgroup)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	k.Cgroup = parseCgroup(string(b))
+	k.Runtime, k.ContainerID = parseContainer(k.Cgroup)
+
+	nodeinfo.Kubernetes = k
+	size := len(k.PodName) + len(k.Namespace) + len(k.PodUID) + len(k.PodIP) + len(k.NodeName) + len(k.Cgroup)
+	for _, kv := range append(k.Labels, k.Annotations...) {
+		size += len(kv.Key) + len(kv.Value)
+	}
+	return size, nil
+}
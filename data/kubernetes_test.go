@@ -0,0 +1,114 @@
+package data
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestParseCgroup(t *testing.T) {
+	tests := map[string]string{
+		"0::/system.slice/nodeinfo.service\n":                                 "/system.slice/nodeinfo.service",
+		"12:pids:/docker/abc\n4:memory:/docker/abc\n1:name=systemd:/\n0::/\n": "/docker/abc",
+		"1:name=systemd:/\n0::/\n":                                            "",
+		"":                                                                    "",
+	}
+	for contents, want := range tests {
+		if got := parseCgroup(contents); got != want {
+			t.Errorf("parseCgroup(%q) = %q, wanted %q", contents, got, want)
+		}
+	}
+}
+
+func TestParseContainer(t *testing.T) {
+	id := "4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b"
+	tests := []struct {
+		cgroup      string
+		wantRuntime string
+		wantID      string
+	}{
+		{"/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + id + ".scope", "containerd", id},
+		{"/kubepods.slice/kubepods-pod1.slice/crio-" + id + ".scope", "crio", id},
+		{"/system.slice/docker-" + id + ".scope", "docker", id},
+		{"/docker/" + id, "docker", id},
+		{"/kubepods/besteffort/pod1/" + id, "", id},
+		{"/system.slice/nodeinfo.service", "", ""},
+	}
+	for _, tt := range tests {
+		runtime, id := parseContainer(tt.cgroup)
+		if runtime != tt.wantRuntime || id != tt.wantID {
+			t.Errorf("parseContainer(%q) = %q, %q, wanted %q, %q", tt.cgroup, runtime, id, tt.wantRuntime, tt.wantID)
+		}
+	}
+}
+
+func TestKubernetesCollector(t *testing.T) {
+	defer func(dir, cgroup string) { podInfoDir, selfCgroup = dir, cgroup }(podInfoDir, selfCgroup)
+	podInfoDir, selfCgroup = "../testdata/kubernetes/podinfo", "../testdata/kubernetes/cgroup"
+	t.Setenv("POD_NAME", "nodeinfo-x7k2p")
+	t.Setenv("POD_NAMESPACE", "default")
+	t.Setenv("NODE_NAME", "mlab1-lga0t.mlab-sandbox.measurement-lab.org")
+	t.Setenv("POD_UID", "")
+	t.Setenv("POD_IP", "")
+	g := Gatherer{
+		Name:    "kubernetes",
+		Type:    "kubernetes",
+		Exclude: []string{"kubectl.kubernetes.io/*", "controller-revision-hash"},
+	}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, wanted nil", err)
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	r := g.Gather(false, nodeinfo)
+	if r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	want := &api.Kubernetes{
+		PodName:   "nodeinfo-x7k2p",
+		Namespace: "default",
+		NodeName:  "mlab1-lga0t.mlab-sandbox.measurement-lab.org",
+		Revision:  "7d9f8b6c5",
+		Labels: []api.KeyValue{
+			{Key: "app", Value: "nodeinfo"},
+			{Key: "pod-template-generation", Value: "3"},
+			{Key: "workload.m-lab.net/role", Value: "experiment"},
+		},
+		Annotations: []api.KeyValue{
+			{Key: "kubernetes.io/config.seen", Value: "2023-10-01T12:00:00.000000000Z"},
+			{Key: "kubernetes.io/config.source", Value: "api"},
+		},
+		Cgroup:      "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1f7c2a5e_6f9b_4c1e_9d8a_0b3c4d5e6f70.slice/cri-containerd-4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b.scope",
+		Runtime:     "containerd",
+		ContainerID: "4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b",
+	}
+	if !reflect.DeepEqual(nodeinfo.Kubernetes, want) {
+		t.Errorf("Kubernetes = %#v, wanted %#v", nodeinfo.Kubernetes, want)
+	}
+}
+
+func TestKubernetesCollectorOutsideKubernetes(t *testing.T) {
+	defer func(dir, cgroup string) { podInfoDir, selfCgroup = dir, cgroup }(podInfoDir, selfCgroup)
+	podInfoDir, selfCgroup = t.TempDir(), "/this/does/not/exist"
+	t.Setenv("POD_NAME", "")
+	g := Gatherer{Name: "kubernetes", Type: "kubernetes"}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if nodeinfo.Kubernetes == nil || nodeinfo.Kubernetes.PodName != "" || nodeinfo.Kubernetes.Labels != nil {
+		t.Errorf("Kubernetes = %#v, wanted an empty record", nodeinfo.Kubernetes)
+	}
+}
+
+func TestParseDownwardAPIMalformed(t *testing.T) {
+	for _, contents := range []string{"app\n", "app=nodeinfo\n"} {
+		filename := t.TempDir() + "/labels"
+		rtx.Must(ioutil.WriteFile(filename, []byte(contents), 0o666), "failed to write %v", filename)
+		if _, err := parseDownwardAPI(filename); err == nil {
+			t.Errorf("parseDownwardAPI(%q) = nil, wanted an error", contents)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ioClasses maps every supported I/O scheduling class to the ionice class
+// number.
+var ioClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// Limits asks for a gatherer's command to be run with fewer privileges and
+// bounded resources, so that e.g. a heavy lshw scan doesn't disturb
+// measurements on the node. The resource limits are applied the way prlimit,
+// nice and ionice apply them, before the command starts. Zero values leave the
+// corresponding setting alone.
+//
+// Those wrapper commands, and nsenter for gatherers with Namespaces, run as the
+// User too. A User other than root therefore can't be combined with a negative
+// Nice, the realtime IOClass or Namespaces, which all need root.
+type Limits struct {
+	// User and Group are names or numeric IDs to run the command as.
+	User  string `json:",omitempty"`
+	Group string `json:",omitempty"`
+
+	// CPUSeconds, AddressSpace (in bytes) and OpenFiles set RLIMIT_CPU,
+	// RLIMIT_AS and RLIMIT_NOFILE.
+	CPUSeconds   uint64 `json:",omitempty"`
+	AddressSpace uint64 `json:",omitempty"`
+	OpenFiles    uint64 `json:",omitempty"`
+
+	// Nice is the niceness, from -20 to 19.
+	Nice int `json:",omitempty"`
+	// IOClass is realtime, best-effort or idle, and IOLevel is the priority
+	// within the realtime and best-effort classes, from 0 to 7.
+	IOClass string `json:",omitempty"`
+	IOLevel int    `json:",omitempty"`
+}
+
+// Validate checks that the user and group exist and that every limit is in
+// range and can be applied as the user.
+func (l *Limits) Validate() error {
+	if _, err := l.credential(); err != nil {
+		return err
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return fmt.Errorf("nice level %d is not between -20 and 19", l.Nice)
+	}
+	if l.dropsRoot() && l.Nice < 0 {
+		return fmt.Errorf("nice level %d needs root, but the command runs as user %q", l.Nice, l.User)
+	}
+	if l.dropsRoot() && l.IOClass == "realtime" {
+		return fmt.Errorf("the realtime I/O class needs root, but the command runs as user %q", l.User)
+	}
+	if _, ok := ioClasses[l.IOClass]; l.IOClass != "" && !ok {
+		return fmt.Errorf("unknown I/O class %q", l.IOClass)
+	}
+	if l.IOLevel < 0 || l.IOLevel > 7 {
+		return fmt.Errorf("I/O level %d is not between 0 and 7", l.IOLevel)
+	}
+	return nil
+}
+
+// lookupID returns the numeric form of a user or group given by name or ID.
+func lookupID(name string, lookup func(string) (string, error)) (uint32, error) {
+	id, err := strconv.ParseUint(name, 10, 32)
+	if err == nil {
+		return uint32(id), nil
+	}
+	s, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	id, err = strconv.ParseUint(s, 10, 32)
+	return uint32(id), err
+}
+
+// credential returns who to run the command as, or nil to run it as nodeinfo.
+// Without a Group, the command runs with the primary group of the User.
+func (l *Limits) credential() (*syscall.Credential, error) {
+	if l.User == "" && l.Group == "" {
+		return nil, nil
+	}
+	c := &syscall.Credential{Uid: uint32(syscall.Getuid()), Gid: uint32(syscall.Getgid())}
+	if l.User != "" {
+		uid, err := lookupID(l.User, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %q (error: %v)", l.User, err)
+		}
+		c.Uid = uid
+		if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil && l.Group == "" {
+			if gid, err := strconv.ParseUint(u.Gid, 10, 32); err == nil {
+				c.Gid = uint32(gid)
+			}
+		}
+	}
+	if l.Group != "" {
+		gid, err := lookupID(l.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown group %q (error: %v)", l.Group, err)
+		}
+		c.Gid = gid
+	}
+	// Supplementary groups are dropped along with the user.
+	c.Groups = []uint32{}
+	return c, nil
+}
+
+// dropsRoot returns whether the command runs as a user other than root.
+func (l *Limits) dropsRoot() bool {
+	if l == nil {
+		return false
+	}
+	c, err := l.credential()
+	return err == nil && c != nil && c.Uid != 0
+}
+
+// wrap returns the command prefixed by the prlimit, nice and ionice commands
+// that apply the limits.
+func (l *Limits) wrap(cmd []string) ([]string, error) {
+	var prefix []string
+	var rlimits []string
+	if l.CPUSeconds > 0 {
+		rlimits = append(rlimits, fmt.Sprintf("--cpu=%d", l.CPUSeconds))
+	}
+	if l.AddressSpace > 0 {
+		rlimits = append(rlimits, fmt.Sprintf("--as=%d", l.AddressSpace))
+	}
+	if l.OpenFiles > 0 {
+		rlimits = append(rlimits, fmt.Sprintf("--nofile=%d", l.OpenFiles))
+	}
+	if len(rlimits) > 0 {
+		prlimit, err := exec.LookPath("prlimit")
+		if err != nil {
+			return nil, err
+		}
+		prefix = append(append([]string{prlimit}, rlimits...), "--")
+	}
+	if l.Nice != 0 {
+		nice, err := exec.LookPath("nice")
+		if err != nil {
+			return nil, err
+		}
+		prefix = append(prefix, nice, "-n", strconv.Itoa(l.Nice), "--")
+	}
+	if l.IOClass != "" {
+		ionice, err := exec.LookPath("ionice")
+		if err != nil {
+			return nil, err
+		}
+		prefix = append(prefix, ionice, "-c", ioClasses[l.IOClass])
+		if l.IOClass != "idle" {
+			prefix = append(prefix, "-n", strconv.Itoa(l.IOLevel))
+		}
+		prefix = append(prefix, "--")
+	}
+	return append(prefix, cmd...), nil
+}
+
+// command returns the command to run the gatherer's command with the limits
+// applied.
+func (l *Limits) command(cmd []string) (*exec.Cmd, error) {
+	if l == nil {
+		return exec.Command(cmd[0], cmd[1:]...), nil
+	}
+	wrapped, err := l.wrap(cmd)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := l.credential()
+	if err != nil {
+		return nil, err
+	}
+	c := exec.Command(wrapped[0], wrapped[1:]...)
+	if credential != nil {
+		c.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+	return c, nil
+}
+
+// String describes the limits that are set, e.g. "user=nobody cpu=10
+// nice=10", for recording along with the output.
+func (l *Limits) String() string {
+	if l == nil {
+		return ""
+	}
+	var parts []string
+	add := func(isSet bool, name string, value interface{}) {
+		if isSet {
+			parts = append(parts, fmt.Sprintf("%s=%v", name, value))
+		}
+	}
+	add(l.User != "", "user", l.User)
+	add(l.Group != "", "group", l.Group)
+	add(l.CPUSeconds > 0, "cpu", l.CPUSeconds)
+	add(l.AddressSpace > 0, "as", l.AddressSpace)
+	add(l.OpenFiles > 0, "nofile", l.OpenFiles)
+	add(l.Nice != 0, "nice", l.Nice)
+	add(l.IOClass != "", "ioclass", l.IOClass)
+	add(l.IOClass != "" && l.IOClass != "idle", "iolevel", l.IOLevel)
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,145 @@
+package data
+
+import (
+	"os"
+	"os/user"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestLimitsValidate(t *testing.T) {
+	good := []Limits{
+		{},
+		{User: "0", Group: "0", CPUSeconds: 10, Nice: 19, IOClass: "idle"},
+		{User: "root", Nice: -20, IOClass: "best-effort", IOLevel: 7},
+		{User: "0", IOClass: "realtime"},
+		{User: "nobody", Nice: 5, IOClass: "best-effort"},
+	}
+	for _, l := range good {
+		if err := l.Validate(); err != nil {
+			t.Errorf("%#v.Validate() = %v, wanted nil", l, err)
+		}
+	}
+	bad := []Limits{
+		{User: "no-such-user-here"},
+		{Group: "no-such-group-here"},
+		{Nice: 20},
+		{Nice: -21},
+		{IOClass: "fast"},
+		{IOClass: "best-effort", IOLevel: 8},
+		{User: "nobody", Nice: -5},
+		{User: "nobody", IOClass: "realtime"},
+	}
+	for _, l := range bad {
+		if err := l.Validate(); err == nil {
+			t.Errorf("%#v.Validate() = nil, wanted an error", l)
+		}
+	}
+}
+
+func TestLimitsString(t *testing.T) {
+	tests := map[string]*Limits{
+		"":                                      nil,
+		"cpu=10 nofile=64":                      {CPUSeconds: 10, OpenFiles: 64},
+		"user=nobody nice=10":                   {User: "nobody", Nice: 10},
+		"ioclass=idle":                          {IOClass: "idle", IOLevel: 4},
+		"as=1024 ioclass=best-effort iolevel=7": {AddressSpace: 1024, IOClass: "best-effort", IOLevel: 7},
+	}
+	for want, l := range tests {
+		if got := l.String(); got != want {
+			t.Errorf("%#v.String() = %q, wanted %q", l, got, want)
+		}
+	}
+}
+
+func TestLimitsWrap(t *testing.T) {
+	l := &Limits{CPUSeconds: 10, OpenFiles: 64, Nice: 5, IOClass: "idle"}
+	got, err := l.wrap([]string{"lshw", "-json"})
+	if err != nil {
+		t.Fatalf("wrap() = %v, wanted nil", err)
+	}
+	var flags []string
+	for _, arg := range got {
+		if len(arg) > 0 && arg[0] != '/' {
+			flags = append(flags, arg)
+		}
+	}
+	want := []string{"--cpu=10", "--nofile=64", "--", "-n", "5", "--", "-c", "3", "--", "lshw", "-json"}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("wrap() = %q, wanted the flags %q", got, want)
+	}
+}
+
+func TestLimitsRunaway(t *testing.T) {
+	// Without the CPU limit, the helper would spin until the outer timeout.
+	g := Gatherer{
+		Name:   "runaway",
+		Cmd:    []string{"timeout", "30", "sh", "-c", "while :; do :; done"},
+		Limits: &Limits{CPUSeconds: 1},
+	}
+	r := g.Gather(false, &api.NodeInfoV1{})
+	if r.Err == nil {
+		t.Error("Gather() = nil, wanted the runaway helper to be killed")
+	}
+	if r.Duration > 15*time.Second {
+		t.Errorf("Gather() took %v, wanted the CPU limit to stop it", r.Duration)
+	}
+}
+
+func TestLimitsOpenFiles(t *testing.T) {
+	cmd := []string{"sh", "-c", "exec 3</dev/null 4</dev/null 5</dev/null 6</dev/null 7</dev/null && echo opened"}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := (Gatherer{Name: "files", Cmd: cmd}).Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() without limits = %v, wanted nil", r.Err)
+	}
+	if r := (Gatherer{Name: "files", Cmd: cmd, Limits: &Limits{OpenFiles: 5}}).Gather(false, nodeinfo); r.Err == nil {
+		t.Error("Gather() = nil, wanted too many open files")
+	}
+	if len(nodeinfo.Commands) != 1 || nodeinfo.Commands[0].Output != "opened" {
+		t.Errorf("Commands = %#v, wanted only the unlimited run", nodeinfo.Commands)
+	}
+}
+
+func TestLimitsPriorities(t *testing.T) {
+	nodeinfo := &api.NodeInfoV1{}
+	gatherers := []Gatherer{
+		{Name: "nice", Cmd: []string{"nice"}, Limits: &Limits{Nice: 5}},
+		{Name: "ionice", Cmd: []string{"ionice"}, Limits: &Limits{IOClass: "idle"}},
+		// The items are enumerated with the limits too.
+		{Name: "each", Cmd: []string{"echo", "{{.Item}}"}, ForEach: &ForEach{Cmd: []string{"nice"}}, Limits: &Limits{Nice: 7}},
+	}
+	for _, g := range gatherers {
+		if r := g.Gather(false, nodeinfo); r.Err != nil {
+			t.Fatalf("Gather(%v) = %v, wanted nil", g.Name, r.Err)
+		}
+	}
+	want := []api.CmdOut{
+		{Name: "nice", CommandLine: "nice", Output: "5", Limits: "nice=5"},
+		{Name: "ionice", CommandLine: "ionice", Output: "idle", Limits: "ioclass=idle"},
+		{Name: "each", CommandLine: "echo 7", Output: "7", Item: "7", Limits: "nice=7"},
+	}
+	if got := withoutUsage(nodeinfo.Commands); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands = %#v, wanted %#v", got, want)
+	}
+}
+
+func TestLimitsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing user needs root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("there is no nobody user")
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	g := Gatherer{Name: "id", Cmd: []string{"id", "-u"}, Limits: &Limits{User: "nobody"}}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if got := nodeinfo.Commands[0].Output; got != nobody.Uid {
+		t.Errorf("id -u = %q, wanted %q", got, nobody.Uid)
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// Load reads a file written by Save back into a NodeInfoV1. The compression is
+// determined by the file extension and the layout by the file contents.
+func Load(filename string) (api.NodeInfoV1, error) {
+	var nodeinfo api.NodeInfoV1
+	f, err := os.Open(filename)
+	if err != nil {
+		return nodeinfo, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(filename, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nodeinfo, err
+		}
+		defer gz.Close()
+		r = gz
+	case strings.HasSuffix(filename, ".zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nodeinfo, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nodeinfo, err
+	}
+	return unmarshal(b)
+}
+
+// unmarshal parses data in either the document or the NDJSON layout.
+func unmarshal(b []byte) (api.NodeInfoV1, error) {
+	var nodeinfo api.NodeInfoV1
+	var values []json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nodeinfo, err
+		}
+		values = append(values, v)
+	}
+	if len(values) == 1 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(values[0], &fields); err != nil {
+			return nodeinfo, err
+		}
+		if _, ok := fields["commands"]; ok {
+			err := json.Unmarshal(values[0], &nodeinfo)
+			return nodeinfo, err
+		}
+	}
+	rows := make([]api.CmdRowV1, len(values))
+	for i := range values {
+		if err := json.Unmarshal(values[i], &rows[i]); err != nil {
+			return nodeinfo, err
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Index < rows[j].Index })
+	for _, row := range rows {
+		nodeinfo.Commands = append(nodeinfo.Commands, api.CmdOut{
+			Name:        row.Name,
+			CommandLine: row.CommandLine,
+			Output:      row.Output,
+			Namespaces:  row.Namespaces,
+			Item:        row.Item,
+			Limits:      row.Limits,
+			Usage:       row.Usage,
+		})
+	}
+	return nodeinfo, nil
+}
+
+// Latest returns the name of the last file saved on the given UTC date under
+// the datatype directory.
+func Latest(datadir, datatype string, date time.Time) (string, error) {
+	dir := fmt.Sprintf("%s/%s/%s", datadir, datatype, date.UTC().Format("2006/01/02"))
+	files, err := filepath.Glob(dir + "/*.json*")
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files were saved in %v", dir)
+	}
+	// Filenames start with their timestamp, so they sort chronologically.
+	sort.Strings(files)
+	return files[len(files)-1], nil
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoad")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	nodeinfo1 := api.NodeInfoV1{
+		Commands: []api.CmdOut{
+			{Name: "name1", CommandLine: "cmdLine1", Output: "output1"},
+			{Name: "name2", CommandLine: "cmdLine2", Output: "output2"},
+		},
+	}
+	for _, layout := range Layouts {
+		for _, compression := range Compressions {
+			result, err := Save(dir, "nodeinfo1", layout, compression, nodeinfo1)
+			rtx.Must(err, "failed to save")
+			got, err := Load(result.Filename)
+			if err != nil {
+				t.Errorf("Load(%v, %v) = %v, wanted nil", layout, compression, err)
+			}
+			if !reflect.DeepEqual(got, nodeinfo1) {
+				t.Errorf("Load(%v, %v) = %#v, wanted %#v", layout, compression, got, nodeinfo1)
+			}
+		}
+	}
+
+	rtx.Must(ioutil.WriteFile(dir+"/bad.json", []byte("not json"), 0o666), "failed to write bad file")
+	for _, file := range []string{dir + "/bad.json", dir + "/missing.json"} {
+		if _, err := Load(file); err == nil {
+			t.Errorf("Load(%q) = nil, wanted error", file)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLatest")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	day := dir + "/nodeinfo1/2023/06/01"
+	rtx.Must(os.MkdirAll(day, 0o775), "failed to create day dir")
+	for _, name := range []string{"20230601T010000.000000Z.json", "20230601T230000.000000Z.json.gz", "20230601T120000.000000Z.json"} {
+		rtx.Must(ioutil.WriteFile(day+"/"+name, nil, 0o666), "failed to write %v", name)
+	}
+
+	got, err := Latest(dir, "nodeinfo1", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	rtx.Must(err, "failed to find latest file")
+	if want := day + "/20230601T230000.000000Z.json.gz"; got != want {
+		t.Errorf("Latest() = %q, wanted %q", got, want)
+	}
+	if _, err := Latest(dir, "nodeinfo1", time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("Latest() = nil, wanted error for a day without data")
+	}
+}
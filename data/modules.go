@@ -0,0 +1,145 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// modulesCollector records the loaded kernel modules from /proc/modules, with
+// the versions they declare in /sys/module, and decodes
+// /proc/sys/kernel/tainted into the flags explaining why the kernel is
+// tainted. Include and Exclude select modules by name, but the taint is always
+// recorded.
+type modulesCollector struct{}
+
+func (modulesCollector) validate(g Gatherer) error {
+	return validatePatterns(g)
+}
+
+// taintFlags names the bits of /proc/sys/kernel/tainted, as documented in the
+// kernel's admin-guide/tainted-kernels.rst.
+var taintFlags = []string{
+	"proprietary_module",
+	"forced_module",
+	"cpu_out_of_spec",
+	"forced_rmmod",
+	"machine_check",
+	"bad_page",
+	"user",
+	"die",
+	"overridden_acpi_table",
+	"warn",
+	"staging",
+	"firmware_workaround",
+	"oot_module",
+	"unsigned_module",
+	"softlockup",
+	"livepatch",
+	"aux",
+	"randstruct",
+	"test",
+}
+
+// decodeTaint returns the names of the bits set in a kernel taint value.
+// Bits without a name are reported by number.
+func decodeTaint(value uint64) []string {
+	var flags []string
+	for bit := 0; bit < 64; bit++ {
+		if value&(1<<bit) == 0 {
+			continue
+		}
+		if bit < len(taintFlags) {
+			flags = append(flags, taintFlags[bit])
+		} else {
+			flags = append(flags, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return flags
+}
+
+// parseModule parses a single line of /proc/modules, which looks like
+//
+//	nf_nat 49152 2 xt_MASQUERADE,iptable_nat, Live 0xffffffffc0a00000 (OE)
+//
+// where the modules using it are "-" if there are none and the taint flags are
+// absent if the module doesn't taint the kernel.
+func parseModule(line string) (api.Module, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return api.Module{}, fmt.Errorf("malformed modules line %q", line)
+	}
+	m := api.Module{Name: fields[0], State: fields[4]}
+	var err error
+	if m.Size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return api.Module{}, fmt.Errorf("malformed modules line %q", line)
+	}
+	if m.RefCount, err = strconv.Atoi(fields[2]); err != nil {
+		return api.Module{}, fmt.Errorf("malformed modules line %q", line)
+	}
+	for _, user := range strings.Split(fields[3], ",") {
+		if user != "" && user != "-" {
+			m.UsedBy = append(m.UsedBy, user)
+		}
+	}
+	if len(fields) > 6 {
+		m.Taints = strings.Trim(fields[6], "()")
+	}
+	return m, nil
+}
+
+func (modulesCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	b, err := os.ReadFile(g.path("/proc/sys/kernel/tainted"))
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	nodeinfo.Taint = &api.Taint{Value: int64(value), Flags: decodeTaint(value)}
+	size := len(b)
+
+	f, err := os.Open(g.path("/proc/modules"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	byName := make(map[string]api.Module)
+	for _, m := range nodeinfo.Modules {
+		byName[m.Name] = m
+	}
+	sysModule := g.path("/sys/module")
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m, err := parseModule(scanner.Text())
+		if err != nil {
+			return 0, err
+		}
+		if !selected(g, m.Name) {
+			continue
+		}
+		// Only modules that declare a version have these attributes.
+		m.Version = readSysfs(filepath.Join(sysModule, m.Name, "version"))
+		m.SrcVersion = readSysfs(filepath.Join(sysModule, m.Name, "srcversion"))
+		size += len(m.Name) + len(m.State) + len(m.Version) + len(m.SrcVersion) + len(m.Taints)
+		byName[m.Name] = m
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	nodeinfo.Modules = nodeinfo.Modules[:0]
+	for _, m := range byName {
+		nodeinfo.Modules = append(nodeinfo.Modules, m)
+	}
+	sort.Slice(nodeinfo.Modules, func(i, j int) bool { return nodeinfo.Modules[i].Name < nodeinfo.Modules[j].Name })
+	return size, nil
+}
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeTaint(t *testing.T) {
+	tests := map[uint64][]string{
+		0:       nil,
+		1:       {"proprietary_module"},
+		12289:   {"proprietary_module", "oot_module", "unsigned_module"},
+		1 << 40: {"bit40"},
+	}
+	for value, want := range tests {
+		if got := decodeTaint(value); !reflect.DeepEqual(got, want) {
+			t.Errorf("decodeTaint(%d) = %q, wanted %q", value, got, want)
+		}
+	}
+}
+
+func TestParseModule(t *testing.T) {
+	for _, line := range []string{"", "ixgbe 339968 0 -", "ixgbe big 0 - Live 0x0", "ixgbe 339968 many - Live 0x0"} {
+		if _, err := parseModule(line); err == nil {
+			t.Errorf("parseModule(%q) = nil, wanted an error", line)
+		}
+	}
+}
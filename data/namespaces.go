@@ -0,0 +1,136 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// nsenterFlags maps every supported namespace type to the nsenter flag that
+// enters it.
+var nsenterFlags = map[string]string{
+	"cgroup": "-C",
+	"ipc":    "-i",
+	"mnt":    "-m",
+	"net":    "-n",
+	"pid":    "-p",
+	"user":   "-U",
+	"uts":    "-u",
+}
+
+// Namespaces asks for a gatherer's command to be run inside the namespaces of
+// another process, the way nsenter does. This lets a containerized nodeinfo
+// report the host's view of e.g. the network, when the pod can see host
+// processes. If Fallback is set and the namespaces can't be entered, the
+// command is run directly instead.
+type Namespaces struct {
+	Target   int
+	Types    []string
+	Fallback bool `json:",omitempty"`
+}
+
+// entersMounts reports whether the command runs in another mount namespace,
+// and so sees other files than nodeinfo does.
+func (n *Namespaces) entersMounts() bool {
+	if n == nil {
+		return false
+	}
+	for _, t := range n.Types {
+		if t == "mnt" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the target and every namespace type are valid.
+func (n *Namespaces) Validate() error {
+	if n.Target <= 0 {
+		return fmt.Errorf("invalid namespace target pid %d", n.Target)
+	}
+	if len(n.Types) == 0 {
+		return errors.New("no namespace types to enter")
+	}
+	for _, t := range n.Types {
+		if _, ok := nsenterFlags[t]; !ok {
+			return fmt.Errorf("unknown namespace type %q", t)
+		}
+	}
+	return nil
+}
+
+// describe returns the identity of every namespace of the process, e.g.
+// "net:[4026531992] uts:[4026531838]", where pid is a number or "self".
+func (n *Namespaces) describe(pid string) (string, error) {
+	var ids []string
+	for _, t := range n.Types {
+		id, err := os.Readlink("/proc/" + pid + "/ns/" + t)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	return strings.Join(ids, " "), nil
+}
+
+// wrap returns a copy of the gatherer whose command enters the namespaces
+// before running the original command, along with the identity of the
+// namespaces it will enter.
+func (n *Namespaces) wrap(g Gatherer) (Gatherer, string, error) {
+	target := strconv.Itoa(n.Target)
+	ids, err := n.describe(target)
+	if err != nil {
+		return g, "", err
+	}
+	nsenter, err := exec.LookPath("nsenter")
+	if err != nil {
+		return g, "", err
+	}
+	cmd := []string{nsenter, "-t", target}
+	for _, t := range n.Types {
+		cmd = append(cmd, nsenterFlags[t])
+	}
+	g.Cmd = append(append(cmd, "--"), g.Cmd...)
+	return g, ids, nil
+}
+
+// isNsenterError reports whether the error came from nsenter failing to enter
+// the namespaces, rather than from the command run inside them.
+func isNsenterError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && bytes.HasPrefix(exitErr.Stderr, []byte("nsenter:"))
+}
+
+// run runs the gatherer's command with the runner, inside the namespaces if
+// possible, and returns its output and resource usage along with the
+// namespaces it ran in. Replayed outputs are read by the gatherer's name
+// without looking for the namespaces, as the target need not exist.
+func (n *Namespaces) run(runner Runner, g Gatherer) ([]byte, *api.Usage, string, error) {
+	if _, ok := runner.(ReplayRunner); ok {
+		out, u, err := runner.Run(g)
+		return out, u, "", err
+	}
+	wrapped, ids, err := n.wrap(g)
+	if err == nil {
+		var out []byte
+		var u *api.Usage
+		out, u, err = runner.Run(wrapped)
+		if err == nil || !isNsenterError(err) {
+			return out, u, ids, err
+		}
+	}
+	if !n.Fallback {
+		return nil, nil, "", fmt.Errorf("failed to enter the namespaces of pid %d (error: %v)", n.Target, err)
+	}
+	// Record our own namespaces, so the data shows the command did not run in
+	// the target's.
+	ids, _ = n.describe("self")
+	out, u, err := runner.Run(g)
+	return out, u, ids, err
+}
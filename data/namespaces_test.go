@@ -0,0 +1,161 @@
+package data
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestNamespacesValidate(t *testing.T) {
+	tests := []struct {
+		n       Namespaces
+		wantErr bool
+	}{
+		{n: Namespaces{Target: 1, Types: []string{"net", "uts"}}},
+		{n: Namespaces{Target: 0, Types: []string{"net"}}, wantErr: true},
+		{n: Namespaces{Target: 1}, wantErr: true},
+		{n: Namespaces{Target: 1, Types: []string{"time-travel"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.n.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%#v.Validate() = %v, wantErr %v", tt.n, err, tt.wantErr)
+		}
+	}
+}
+
+// startNamespacedProcess starts a process in new user and UTS namespaces with
+// its own hostname, which needs no privileges on kernels that allow
+// unprivileged user namespaces. The test is skipped if that is not possible.
+func startNamespacedProcess(t *testing.T, hostname string) *exec.Cmd {
+	if _, err := exec.LookPath("nsenter"); err != nil {
+		t.Skip("nsenter is not installed")
+	}
+	cmd := exec.Command("sh", "-c", "hostname "+hostname+" && echo ready && exec sleep 60")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("user namespaces are not available (error: %v)", err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "ready\n" {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Skipf("could not set the hostname in a user namespace (error: %v)", err)
+	}
+	return cmd
+}
+
+func TestGatherInNamespaces(t *testing.T) {
+	child := startNamespacedProcess(t, "nsworld")
+	defer func() {
+		child.Process.Kill()
+		child.Wait()
+	}()
+
+	g := Gatherer{
+		Name:       "hostname",
+		Cmd:        []string{"hostname"},
+		Namespaces: &Namespaces{Target: child.Process.Pid, Types: []string{"user", "uts"}},
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	cmd := nodeinfo.Commands[0]
+	if cmd.Output != "nsworld" {
+		t.Errorf("Output = %q, wanted the hostname inside the namespace", cmd.Output)
+	}
+	if cmd.CommandLine != "hostname" {
+		t.Errorf("CommandLine = %q, wanted the configured command", cmd.CommandLine)
+	}
+	self, err := os.Readlink("/proc/self/ns/uts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cmd.Namespaces, "uts:[") || strings.Contains(cmd.Namespaces, self) {
+		t.Errorf("Namespaces = %q, wanted the target's uts namespace, not %q", cmd.Namespaces, self)
+	}
+}
+
+func TestForEachInNamespaces(t *testing.T) {
+	child := startNamespacedProcess(t, "nsworld")
+	defer func() {
+		child.Process.Kill()
+		child.Wait()
+	}()
+
+	// The items are enumerated in the namespaces the commands run in.
+	g := Gatherer{
+		Name:       "hostname",
+		Cmd:        []string{"echo", "{{.Item}}"},
+		ForEach:    &ForEach{Cmd: []string{"hostname"}},
+		Namespaces: &Namespaces{Target: child.Process.Pid, Types: []string{"user", "uts"}},
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if len(nodeinfo.Commands) != 1 || nodeinfo.Commands[0].Item != "nsworld" {
+		t.Errorf("Commands = %#v, wanted one for the hostname inside the namespace", nodeinfo.Commands)
+	}
+}
+
+func TestReplayNamespaces(t *testing.T) {
+	defer func() { CommandRunner = ExecRunner{} }()
+	dir := t.TempDir()
+	rtx.Must(ioutil.WriteFile(dir+"/hostname.txt", []byte("nsworld\n"), 0o666), "failed to write fixture")
+	CommandRunner = ReplayRunner{Dir: dir}
+
+	// No process can have this pid, so the fixture is all there is.
+	g := Gatherer{
+		Name:       "hostname",
+		Cmd:        []string{"hostname"},
+		Namespaces: &Namespaces{Target: 1 << 30, Types: []string{"uts"}},
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if cmd := nodeinfo.Commands[0]; cmd.Output != "nsworld" {
+		t.Errorf("Output = %q, wanted the recorded output", cmd.Output)
+	}
+}
+
+func TestGatherNamespacesFallback(t *testing.T) {
+	// No process can have this pid, so its namespaces can never be entered.
+	missing := Namespaces{Target: 1 << 30, Types: []string{"uts"}}
+	self, err := os.Readlink("/proc/self/ns/uts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withFallback := missing
+	withFallback.Fallback = true
+	nodeinfo := &api.NodeInfoV1{}
+	g := Gatherer{Name: "echo", Cmd: []string{"echo", "direct"}, Namespaces: &withFallback}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if cmd := nodeinfo.Commands[0]; cmd.Output != "direct" || cmd.Namespaces != self {
+		t.Errorf("Gather() = %#v, wanted to run directly in %v", cmd, self)
+	}
+
+	g.Namespaces = &missing
+	if r := g.Gather(false, nodeinfo); r.Err == nil {
+		t.Error("Gather() = nil, wanted error without a fallback")
+	}
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// netifCollector records the address, MTU, link state and driver of every
+// interface in /sys/class/net, selected by name, e.g. excluding "veth*". The
+// kernel refuses to report the speed of a link that is down, which is recorded
+// as -1. Setting Ethtool adds what only the driver knows, like its firmware
+// version, ring sizes and offloads.
+type netifCollector struct{}
+
+func (netifCollector) validate(g Gatherer) error {
+	if g.Ethtool && g.UseHostRoot {
+		// The ioctls go to the interfaces of nodeinfo's own network
+		// namespace, which need not be the ones listed in the host's sysfs.
+		return errors.New("ethtool queries can't be combined with UseHostRoot")
+	}
+	return validatePatterns(g)
+}
+
+// readSysfs returns the trimmed contents of a sysfs attribute, or the empty
+// string if it can't be read, e.g. the speed of an interface that is down.
+func readSysfs(p string) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (netifCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	classNet := g.path("/sys/class/net")
+	entries, err := os.ReadDir(classNet)
+	if err != nil {
+		return 0, err
+	}
+	size := 0
+	byName := make(map[string]api.NetInterface)
+	for _, iface := range nodeinfo.Interfaces {
+		byName[iface.Name] = iface
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !selected(g, name) {
+			continue
+		}
+		dir := filepath.Join(classNet, name)
+		iface := api.NetInterface{
+			Name:      name,
+			Address:   readSysfs(filepath.Join(dir, "address")),
+			OperState: readSysfs(filepath.Join(dir, "operstate")),
+			Duplex:    readSysfs(filepath.Join(dir, "duplex")),
+			Speed:     -1,
+		}
+		iface.MTU, _ = strconv.Atoi(readSysfs(filepath.Join(dir, "mtu")))
+		if speed, err := strconv.Atoi(readSysfs(filepath.Join(dir, "speed"))); err == nil && speed >= 0 {
+			iface.Speed = speed
+		}
+		// Virtual interfaces have no device, and so no driver.
+		if driver, err := os.Readlink(filepath.Join(dir, "device", "driver")); err == nil {
+			iface.Driver = filepath.Base(driver)
+		}
+		if g.Ethtool {
+			if err := ethtool(&iface); err != nil {
+				iface.EthtoolError = err.Error()
+			}
+		}
+		size += len(iface.Name) + len(iface.Address) + len(iface.OperState) + len(iface.Duplex) + len(iface.Driver)
+		byName[name] = iface
+	}
+
+	nodeinfo.Interfaces = nodeinfo.Interfaces[:0]
+	for _, iface := range byName {
+		nodeinfo.Interfaces = append(nodeinfo.Interfaces, iface)
+	}
+	sort.Slice(nodeinfo.Interfaces, func(i, j int) bool { return nodeinfo.Interfaces[i].Name < nodeinfo.Interfaces[j].Name })
+	return size, nil
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestNetifCollectorEthtool(t *testing.T) {
+	HostRoot = "../testdata"
+	defer func() { HostRoot = "" }()
+	// The fake interface doesn't exist in the kernel, so the ioctls fail, but
+	// everything read from sysfs is still recorded. Validate refuses this
+	// gatherer, but the fixtures can only be read under HostRoot.
+	g := Gatherer{
+		Name:        "netif",
+		Type:        "netif",
+		Include:     []string{"dummy*"},
+		Ethtool:     true,
+		UseHostRoot: true,
+	}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if len(nodeinfo.Interfaces) != 1 {
+		t.Fatalf("Interfaces = %#v, wanted only dummy9", nodeinfo.Interfaces)
+	}
+	iface := nodeinfo.Interfaces[0]
+	if iface.EthtoolError == "" || iface.MTU != 1500 {
+		t.Errorf("Interfaces[0] = %#v, wanted an ethtool error and the sysfs values", iface)
+	}
+}
+
+func TestNetifCollectorMissing(t *testing.T) {
+	HostRoot = "/this/does/not/exist"
+	defer func() { HostRoot = "" }()
+	g := Gatherer{Name: "netif", Type: "netif", UseHostRoot: true}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error for a missing /sys/class/net")
+	}
+}
+
+func TestCString(t *testing.T) {
+	if got := cString([]byte("ixgbe\x00\x00junk")); got != "ixgbe" {
+		t.Errorf("cString() = %q, wanted %q", got, "ixgbe")
+	}
+	if got := cString([]byte("full")); got != "full" {
+		t.Errorf("cString() = %q, wanted %q", got, "full")
+	}
+}
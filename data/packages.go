@@ -0,0 +1,242 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// packagesCollector records the installed packages from the database of the
+// node's package manager, which is detected from the ID and ID_LIKE of
+// /etc/os-release. The dpkg and apk databases are parsed directly, while rpm's
+// is queried with the rpm command. Include and Exclude select packages by
+// name, e.g. excluding rpm's "gpg-pubkey" signing keys.
+type packagesCollector struct{}
+
+func (packagesCollector) validate(g Gatherer) error {
+	return validatePatterns(g)
+}
+
+// Package managers understood by the packages collector.
+const (
+	managerDpkg = "dpkg"
+	managerApk  = "apk"
+	managerRPM  = "rpm"
+)
+
+// distroManagers maps the distribution IDs of os-release(5) to their package
+// manager.
+var distroManagers = map[string]string{
+	"debian":   managerDpkg,
+	"ubuntu":   managerDpkg,
+	"alpine":   managerApk,
+	"rhel":     managerRPM,
+	"centos":   managerRPM,
+	"fedora":   managerRPM,
+	"amzn":     managerRPM,
+	"suse":     managerRPM,
+	"opensuse": managerRPM,
+}
+
+// rpmQueryFormat prints one tab-separated line per package. Versions are
+// prefixed with the epoch when it is set, as dpkg spells them.
+const rpmQueryFormat = `%{NAME}\t%|EPOCH?{%{EPOCH}:}|%{VERSION}-%{RELEASE}\t%{ARCH}\t%{SOURCERPM}\n`
+
+// detectManager returns the package manager of the distribution described by
+// an os-release file, trying its ID before the IDs it is like.
+func detectManager(filename string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, line := range strings.Split(string(b), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			ids = append([]string{value}, ids...)
+		case "ID_LIKE":
+			ids = append(ids, strings.Fields(value)...)
+		}
+	}
+	for _, id := range ids {
+		if manager, ok := distroManagers[id]; ok {
+			return manager, nil
+		}
+	}
+	return "", fmt.Errorf("no known package manager for distribution %q", strings.Join(ids, " "))
+}
+
+// parseStanzas calls add with the fields of every blank-line separated stanza
+// of "key: value" or "K:value" lines read from r, skipping continuation lines
+// that start with a space.
+func parseStanzas(r io.Reader, sep string, add func(map[string]string)) error {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(fields) > 0 {
+				add(fields)
+			}
+			fields = make(map[string]string)
+			continue
+		}
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, sep); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	if len(fields) > 0 {
+		add(fields)
+	}
+	return scanner.Err()
+}
+
+// dpkgPackages reads the installed packages from a dpkg status database.
+func dpkgPackages(filename string) ([]api.Package, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var packages []api.Package
+	err = parseStanzas(f, ":", func(fields map[string]string) {
+		// Removed packages stay in the database until they are purged.
+		if status := strings.Fields(fields["Status"]); len(status) != 3 || status[2] != "installed" {
+			return
+		}
+		p := api.Package{
+			Name:    fields["Package"],
+			Version: fields["Version"],
+			Arch:    fields["Architecture"],
+			Source:  fields["Package"],
+			Manager: managerDpkg,
+		}
+		// The source may carry its own version, e.g. "bash (5.2.15-2)".
+		if source := strings.Fields(fields["Source"]); len(source) > 0 {
+			p.Source = source[0]
+		}
+		packages = append(packages, p)
+	})
+	return packages, err
+}
+
+// apkPackages reads the installed packages from an apk installed database.
+func apkPackages(filename string) ([]api.Package, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var packages []api.Package
+	err = parseStanzas(f, ":", func(fields map[string]string) {
+		p := api.Package{
+			Name:    fields["P"],
+			Version: fields["V"],
+			Arch:    fields["A"],
+			Source:  fields["o"],
+			Manager: managerApk,
+		}
+		if p.Source == "" {
+			p.Source = p.Name
+		}
+		packages = append(packages, p)
+	})
+	return packages, err
+}
+
+// rpmCommand returns the command that lists the packages in rpm's database.
+func rpmCommand(g Gatherer) []string {
+	cmd := []string{"rpm", "-qa", "--queryformat", rpmQueryFormat}
+	if g.UseHostRoot && HostRoot != "" {
+		cmd = append(cmd, "--root", HostRoot)
+	}
+	return cmd
+}
+
+// rpmPackages lists the installed packages by running rpm, which is the only
+// supported way to read its database.
+func rpmPackages(g Gatherer) ([]api.Package, error) {
+	// The command already points rpm at HostRoot.
+	out, err := g.runHelper(Gatherer{Name: g.Name, Cmd: rpmCommand(g)})
+	if err != nil {
+		return nil, err
+	}
+	var packages []api.Package
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		p := api.Package{Name: fields[0], Version: fields[1], Arch: fields[2], Source: fields[3], Manager: managerRPM}
+		// Source packages are named name-version-release.src.rpm.
+		if i := strings.LastIndex(p.Source, "-"); i > 0 {
+			if j := strings.LastIndex(p.Source[:i], "-"); j > 0 {
+				p.Source = p.Source[:j]
+			}
+		}
+		if p.Source == "(none)" || p.Source == "" {
+			p.Source = p.Name
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+func (packagesCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	manager, err := detectManager(g.path("/etc/os-release"))
+	if err != nil {
+		return 0, err
+	}
+	var packages []api.Package
+	switch manager {
+	case managerDpkg:
+		packages, err = dpkgPackages(g.path("/var/lib/dpkg/status"))
+	case managerApk:
+		packages, err = apkPackages(g.path("/lib/apk/db/installed"))
+	case managerRPM:
+		packages, err = rpmPackages(g)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	size := 0
+	byName := make(map[string]api.Package)
+	for _, p := range nodeinfo.Packages {
+		byName[p.Name+"/"+p.Arch] = p
+	}
+	for _, p := range packages {
+		if !selected(g, p.Name) {
+			continue
+		}
+		size += len(p.Name) + len(p.Version) + len(p.Arch) + len(p.Source)
+		byName[p.Name+"/"+p.Arch] = p
+	}
+
+	nodeinfo.Packages = nodeinfo.Packages[:0]
+	for _, p := range byName {
+		nodeinfo.Packages = append(nodeinfo.Packages, p)
+	}
+	sort.Slice(nodeinfo.Packages, func(i, j int) bool {
+		a, b := nodeinfo.Packages[i], nodeinfo.Packages[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Arch < b.Arch
+	})
+	return size, nil
+}
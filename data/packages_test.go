@@ -0,0 +1,84 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestDetectManager(t *testing.T) {
+	tests := map[string]string{
+		"debian": managerDpkg,
+		"alpine": managerApk,
+		"fedora": managerRPM,
+	}
+	for distro, want := range tests {
+		got, err := detectManager("../testdata/packages/" + distro + "/etc/os-release")
+		if err != nil || got != want {
+			t.Errorf("detectManager(%q) = %q, %v, wanted %q", distro, got, err, want)
+		}
+	}
+	if _, err := detectManager("../testdata/packages/unknown/etc/os-release"); err == nil {
+		t.Error("detectManager(unknown) = nil, wanted an error")
+	}
+	if _, err := detectManager("../testdata/packages/missing/etc/os-release"); err == nil {
+		t.Error("detectManager(missing) = nil, wanted an error")
+	}
+}
+
+func TestPackagesCollector(t *testing.T) {
+	defer func() {
+		HostRoot = ""
+		CommandRunner = ExecRunner{}
+	}()
+	CommandRunner = ReplayRunner{Dir: "../testdata/packages/fedora/fixtures"}
+	tests := []struct {
+		distro  string
+		exclude []string
+		want    []api.Package
+	}{
+		{
+			distro:  "debian",
+			exclude: []string{"zlib*"},
+			want: []api.Package{
+				{Name: "bash", Version: "5.2.15-2+b9", Arch: "amd64", Source: "bash", Manager: "dpkg"},
+				{Name: "libc6", Version: "2.36-9+deb12u13", Arch: "amd64", Source: "glibc", Manager: "dpkg"},
+				{Name: "libc6", Version: "2.36-9+deb12u13", Arch: "i386", Source: "glibc", Manager: "dpkg"},
+			},
+		},
+		{
+			distro: "alpine",
+			want: []api.Package{
+				{Name: "libcrypto3", Version: "3.1.4-r0", Arch: "x86_64", Source: "openssl", Manager: "apk"},
+				{Name: "musl", Version: "1.2.4-r2", Arch: "x86_64", Source: "musl", Manager: "apk"},
+				{Name: "util-linux-misc", Version: "2.38.1-r8", Arch: "x86_64", Source: "util-linux", Manager: "apk"},
+			},
+		},
+		{
+			distro: "fedora",
+			want: []api.Package{
+				{Name: "bash", Version: "5.1.8-6.el9_1", Arch: "x86_64", Source: "bash", Manager: "rpm"},
+				{Name: "gpg-pubkey", Version: "5a6340b3-6229229e", Arch: "(none)", Source: "gpg-pubkey", Manager: "rpm"},
+				{Name: "kernel-core", Version: "5.14.0-284.30.1.el9_2", Arch: "x86_64", Source: "kernel", Manager: "rpm"},
+				{Name: "openssl-libs", Version: "1:3.0.7-24.el9", Arch: "x86_64", Source: "openssl", Manager: "rpm"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		HostRoot = "../testdata/packages/" + tt.distro
+		g := Gatherer{Name: "packages", Type: "packages", Exclude: tt.exclude, UseHostRoot: true}
+		if err := g.Validate(); err != nil {
+			t.Fatalf("Validate() = %v, wanted nil", err)
+		}
+		nodeinfo := &api.NodeInfoV1{}
+		r := g.Gather(false, nodeinfo)
+		if r.Err != nil {
+			t.Errorf("Gather() on %v = %v, wanted nil", tt.distro, r.Err)
+			continue
+		}
+		if !reflect.DeepEqual(nodeinfo.Packages, tt.want) {
+			t.Errorf("Packages on %v = %#v, wanted %#v", tt.distro, nodeinfo.Packages, tt.want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// Policy restricts the commands gatherers may run to an allowlist, so that
+// whoever can edit the config can't run arbitrary commands on every node. It
+// is read from a JSON file such as
+//
+//	{"Rules": [
+//	  {"Path": "/usr/bin/lshw", "Args": ["-json", "-quiet"]},
+//	  {"Path": "/usr/sbin/ethtool", "SHA256": ["9f86d0..."], "Args": ["-i", "eth[0-9]+"]}
+//	]}
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// PolicyRule allows a single executable to be run.
+type PolicyRule struct {
+	// Path is the absolute path of the executable, after resolving symbolic
+	// links.
+	Path string
+	// SHA256 lists the allowed hex SHA-256 hashes of the executable. Any
+	// contents are allowed if it is empty.
+	SHA256 []string `json:",omitempty"`
+	// Args are regular expressions, and every argument must match one of them
+	// in full. No arguments are allowed if it is empty.
+	Args []string `json:",omitempty"`
+
+	args []*regexp.Regexp
+}
+
+// ErrPolicyViolation is wrapped by the errors returned for commands the
+// policy doesn't allow.
+var ErrPolicyViolation = errors.New("command is not allowed by the policy")
+
+// ActivePolicy is checked when the config is loaded and again before every
+// command is run. Every command is allowed if it is nil.
+var ActivePolicy *Policy
+
+// LoadPolicy reads and compiles a policy file.
+func LoadPolicy(filename string) (*Policy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse %v (error: %v)", filename, err)
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule for %q in %v (error: %v)", p.Rules[i].Path, filename, err)
+		}
+	}
+	return p, nil
+}
+
+func (r *PolicyRule) compile() error {
+	if !filepath.IsAbs(r.Path) {
+		return errors.New("the path is not absolute")
+	}
+	r.args = nil
+	for _, pattern := range r.Args {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return err
+		}
+		r.args = append(r.args, re)
+	}
+	return nil
+}
+
+// allowsArg reports whether the argument, or its logical path if it was
+// resolved under HostRoot, matches one of the rule's patterns.
+func (r *PolicyRule) allowsArg(arg string) bool {
+	logical := arg
+	if HostRoot != "" && strings.HasPrefix(arg, HostRoot+"/") {
+		logical = strings.TrimPrefix(arg, HostRoot)
+	}
+	for _, re := range r.args {
+		if re.MatchString(arg) || re.MatchString(logical) {
+			return true
+		}
+	}
+	return false
+}
+
+// openSHA256 opens a file and returns it along with the hex SHA-256 of its
+// contents, so that the file that was hashed can be run rather than whatever
+// is at its path later.
+func openSHA256(filename string) (*os.File, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return f, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolve returns the absolute path of the executable that exec.Command would
+// run, with symbolic links resolved.
+func resolve(name string) (string, error) {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	if p, err = filepath.Abs(p); err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(p)
+}
+
+// allowed is an executable the policy allows, as it must be run.
+type allowed struct {
+	path  string   // The resolved path of the executable.
+	file  *os.File // The executable as it was hashed, if its rule has hashes.
+	index int      // Where the executable is in the gatherer's command.
+}
+
+// close closes the hashed executable, if there is one.
+func (a *allowed) close() {
+	if a != nil && a.file != nil {
+		a.file.Close()
+	}
+}
+
+// apply makes the command run the allowed executable, rather than whatever a
+// second lookup of its name would find. The name the executable is run by is
+// kept, unless the command wraps it in another, like prlimit or nsenter. The
+// prefix is the number of arguments such wrappers added to the gatherer's
+// command.
+func (a *allowed) apply(cmd *exec.Cmd, prefix int) {
+	if a == nil || a.path == "" {
+		return
+	}
+	exe := a.path
+	if a.file != nil {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, a.file)
+		exe = fmt.Sprintf("/proc/self/fd/%d", 2+len(cmd.ExtraFiles))
+	}
+	if i := prefix + a.index; i == 0 {
+		cmd.Path = exe
+	} else {
+		cmd.Args[i] = exe
+	}
+}
+
+// check returns an error wrapping ErrPolicyViolation unless the policy allows
+// the command, and otherwise the executable to run. With checkArgs unset, only
+// the executable is checked. Rules with hashes never allow commands that run
+// in another mount namespace, where the executable need not be the one hashed.
+func (p *Policy) check(cmd []string, checkArgs, otherMounts bool) (*allowed, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("%w: empty command", ErrPolicyViolation)
+	}
+	path, err := resolve(cmd[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q can't be found (error: %v)", ErrPolicyViolation, cmd[0], err)
+	}
+	var reasons []string
+	var file *os.File
+	var sum string
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Path != path {
+			continue
+		}
+		if len(r.SHA256) > 0 {
+			if otherMounts {
+				reasons = append(reasons, "hashes can't be checked in another mount namespace")
+				continue
+			}
+			if file == nil {
+				if file, sum, err = openSHA256(path); err != nil {
+					reasons = append(reasons, err.Error())
+					continue
+				}
+			}
+			if !contains(r.SHA256, sum) {
+				reasons = append(reasons, fmt.Sprintf("%v has hash %v", path, sum))
+				continue
+			}
+		}
+		bad := ""
+		for _, arg := range cmd[1:] {
+			if checkArgs && !r.allowsArg(arg) {
+				bad = arg
+				break
+			}
+		}
+		if bad == "" {
+			a := &allowed{path: path}
+			if len(r.SHA256) > 0 {
+				a.file = file
+			} else if file != nil {
+				file.Close()
+			}
+			return a, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("argument %q is not allowed", bad))
+	}
+	if file != nil {
+		file.Close()
+	}
+	if len(reasons) == 0 {
+		return nil, fmt.Errorf("%w: no rule for %v", ErrPolicyViolation, path)
+	}
+	return nil, fmt.Errorf("%w: %q (%v)", ErrPolicyViolation, strings.Join(cmd, " "), strings.Join(reasons, "; "))
+}
+
+// checkCommand is check for when the command won't be run yet.
+func (p *Policy) checkCommand(cmd []string, checkArgs, otherMounts bool) error {
+	a, err := p.check(cmd, checkArgs, otherMounts)
+	a.close()
+	return err
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckGatherer returns an error wrapping ErrPolicyViolation unless the policy
+// allows every command the gatherer may run. The arguments of ForEach
+// commands are templates, so they are only checked once they are expanded.
+// Built-in collectors read the node directly, except for the packages
+// collector on rpm-based nodes, whose rpm query is checked like any command.
+func (p *Policy) CheckGatherer(g Gatherer) error {
+	if p == nil {
+		return nil
+	}
+	otherMounts := g.Namespaces.entersMounts()
+	if g.Type != "" {
+		if g.Type == "packages" {
+			if manager, err := detectManager(g.path("/etc/os-release")); err == nil && manager == managerRPM {
+				return p.checkCommand(rpmCommand(g), true, otherMounts)
+			}
+		}
+		return nil
+	}
+	if g.ForEach != nil {
+		if len(g.ForEach.Cmd) > 0 {
+			if err := p.checkCommand(g.ForEach.Cmd, true, otherMounts); err != nil {
+				return err
+			}
+		}
+		return p.checkCommand(g.Cmd, false, otherMounts)
+	}
+	return p.checkCommand(g.Cmd, true, otherMounts)
+}
+
+// checkRun is the check made right before a command is run, which returns the
+// executable to run. Commands wrapped by Namespaces are checked without the
+// nsenter that nodeinfo added, and run as they are if they enter another mount
+// namespace, where the path we resolved may not exist.
+func (p *Policy) checkRun(g Gatherer) (*allowed, error) {
+	if p == nil {
+		return nil, nil
+	}
+	cmd := g.Cmd
+	index := 0
+	if g.Namespaces != nil && len(cmd) > 0 && filepath.Base(cmd[0]) == "nsenter" {
+		for i, arg := range cmd {
+			if arg == "--" {
+				cmd = cmd[i+1:]
+				index = i + 1
+				break
+			}
+		}
+	}
+	if g.logicalCmd != nil && len(cmd) == len(g.logicalCmd) {
+		// The arguments are checked as configured, as they were when the
+		// config was loaded, since resolving them under HostRoot may have
+		// followed links on the host.
+		cmd = append([]string{cmd[0]}, g.logicalCmd[1:]...)
+	}
+	otherMounts := g.Namespaces.entersMounts()
+	a, err := p.check(cmd, true, otherMounts)
+	if err != nil {
+		metrics.PolicyViolations.WithLabelValues("run").Inc()
+		return nil, err
+	}
+	if otherMounts {
+		a.path = ""
+	} else {
+		a.index = index
+	}
+	return a, nil
+}
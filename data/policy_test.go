@@ -0,0 +1,250 @@
+package data
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testPolicy returns a policy allowing `uname -a`, `uname -r` and cat of
+// /etc/os-release.
+func testPolicy(t *testing.T, unameHashes ...string) *Policy {
+	uname, err := resolve("uname")
+	rtx.Must(err, "failed to find uname")
+	cat, err := resolve("cat")
+	rtx.Must(err, "failed to find cat")
+	p := &Policy{Rules: []PolicyRule{
+		{Path: uname, SHA256: unameHashes, Args: []string{"-a|-r"}},
+		{Path: cat, Args: []string{"/etc/os-release"}},
+	}}
+	for i := range p.Rules {
+		rtx.Must(p.Rules[i].compile(), "failed to compile rule")
+	}
+	return p
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.json":     `{"Rules": [{"Path": "/usr/bin/uname", "Args": ["-a"]}]}`,
+		"bad.json":      `{"Rules": [`,
+		"relative.json": `{"Rules": [{"Path": "uname"}]}`,
+		"regexp.json":   `{"Rules": [{"Path": "/usr/bin/uname", "Args": ["("]}]}`,
+	}
+	for name, contents := range files {
+		rtx.Must(ioutil.WriteFile(dir+"/"+name, []byte(contents), 0o666), "failed to write %v", name)
+	}
+	p, err := LoadPolicy(dir + "/good.json")
+	if err != nil || len(p.Rules) != 1 || len(p.Rules[0].args) != 1 {
+		t.Errorf("LoadPolicy(good.json) = %#v, %v", p, err)
+	}
+	for _, name := range []string{"bad.json", "relative.json", "regexp.json", "missing.json"} {
+		if _, err := LoadPolicy(dir + "/" + name); err == nil {
+			t.Errorf("LoadPolicy(%v) = nil, wanted an error", name)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	unameHash := hashOf(t, "uname")
+	tests := []struct {
+		name    string
+		policy  *Policy
+		cmd     []string
+		allowed bool
+	}{
+		{"no policy", nil, []string{"rm", "-rf", "/"}, true},
+		{"allowed", testPolicy(t), []string{"uname", "-a"}, true},
+		{"no arguments", testPolicy(t), []string{"uname"}, true},
+		{"bad argument", testPolicy(t), []string{"uname", "-a", "-n"}, false},
+		{"partial match", testPolicy(t), []string{"uname", "-ar"}, false},
+		{"no rule", testPolicy(t), []string{"echo", "hi"}, false},
+		{"not found", testPolicy(t), []string{"this-does-not-exist"}, false},
+		{"empty", testPolicy(t), nil, false},
+		{"matching hash", testPolicy(t, "0000", unameHash), []string{"uname", "-r"}, true},
+		{"wrong hash", testPolicy(t, "0000"), []string{"uname", "-r"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.policy.checkCommand(tt.cmd, true, false)
+		if tt.allowed && err != nil {
+			t.Errorf("%v: check(%q) = %v, wanted nil", tt.name, tt.cmd, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPolicyViolation) {
+			t.Errorf("%v: check(%q) = %v, wanted a policy violation", tt.name, tt.cmd, err)
+		}
+	}
+}
+
+func TestPolicyHostRoot(t *testing.T) {
+	HostRoot = "/host"
+	defer func() { HostRoot = "" }()
+	p := testPolicy(t)
+	if err := p.checkCommand([]string{"cat", "/host/etc/os-release"}, true, false); err != nil {
+		t.Errorf("check() = %v, wanted the logical path to be allowed", err)
+	}
+	if err := p.checkCommand([]string{"cat", "/host/etc/shadow"}, true, false); err == nil {
+		t.Error("check() = nil, wanted an error")
+	}
+}
+
+func TestPolicyHostRootSymlink(t *testing.T) {
+	defer func() { ActivePolicy = nil }()
+	ActivePolicy = testPolicy(t)
+	dir := t.TempDir()
+	rtx.Must(os.MkdirAll(dir+"/etc", 0o775), "failed to create etc")
+	rtx.Must(os.MkdirAll(dir+"/usr/lib", 0o775), "failed to create usr/lib")
+	rtx.Must(ioutil.WriteFile(dir+"/usr/lib/os-release", []byte("ID=hostos\n"), 0o666), "failed to write os-release")
+	rtx.Must(os.Symlink("../usr/lib/os-release", dir+"/etc/os-release"), "failed to link os-release")
+	HostRoot = dir
+	defer func() { HostRoot = "" }()
+
+	// The argument is allowed as configured, even though it resolves to
+	// another path on the host.
+	g := Gatherer{Name: "osrelease", Cmd: []string{"cat", "/etc/os-release"}, UseHostRoot: true}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err != nil {
+		t.Errorf("Gather() = %v, wanted nil", r.Err)
+	}
+}
+
+func TestPolicyCheckGatherer(t *testing.T) {
+	p := testPolicy(t)
+	tests := []struct {
+		g       Gatherer
+		allowed bool
+	}{
+		{Gatherer{Name: "uname", Cmd: []string{"uname", "-a"}}, true},
+		{Gatherer{Name: "uname", Cmd: []string{"uname", "-n"}}, false},
+		{Gatherer{Name: "sysctl", Type: "sysctl", Include: []string{"net.*"}}, true},
+		{Gatherer{Name: "each", Cmd: []string{"cat", "{{.Path}}"}, ForEach: &ForEach{Glob: "/etc/*"}}, true},
+		{Gatherer{Name: "each", Cmd: []string{"echo", "{{.Item}}"}, ForEach: &ForEach{Glob: "/etc/*"}}, false},
+		{Gatherer{Name: "each", Cmd: []string{"cat", "{{.Item}}"}, ForEach: &ForEach{Cmd: []string{"uname", "-a"}}}, true},
+		{Gatherer{Name: "each", Cmd: []string{"cat", "{{.Item}}"}, ForEach: &ForEach{Cmd: []string{"ls"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := p.CheckGatherer(tt.g); (err == nil) != tt.allowed {
+			t.Errorf("CheckGatherer(%#v) = %v, wanted allowed %v", tt.g, err, tt.allowed)
+		}
+	}
+}
+
+func TestPolicyAtRunTime(t *testing.T) {
+	defer func() { ActivePolicy = nil }()
+	ActivePolicy = testPolicy(t)
+
+	nodeinfo := &api.NodeInfoV1{}
+	if r := (Gatherer{Name: "uname", Cmd: []string{"uname", "-a"}}).Gather(false, nodeinfo); r.Err != nil {
+		t.Errorf("Gather(uname -a) = %v, wanted nil", r.Err)
+	}
+	before := testutil.ToFloat64(metrics.PolicyViolations.WithLabelValues("run"))
+	if r := (Gatherer{Name: "echo", Cmd: []string{"echo", "hi"}}).Gather(false, nodeinfo); r.Err == nil {
+		t.Error("Gather(echo hi) = nil, wanted a policy violation")
+	}
+	if got := testutil.ToFloat64(metrics.PolicyViolations.WithLabelValues("run")) - before; got != 1 {
+		t.Errorf("PolicyViolations increased by %v, wanted 1", got)
+	}
+	// Expanded ForEach arguments are checked before they are run.
+	each := Gatherer{Name: "each", Cmd: []string{"uname", "{{.Item}}"}, ForEach: &ForEach{Cmd: []string{"uname", "-a"}}}
+	if r := each.Gather(false, nodeinfo); r.Err == nil {
+		t.Error("Gather(each) = nil, wanted a policy violation for the expanded argument")
+	}
+	if len(nodeinfo.Commands) != 1 {
+		t.Errorf("Commands = %#v, wanted only uname -a", nodeinfo.Commands)
+	}
+}
+
+func TestPolicyNsenter(t *testing.T) {
+	p := testPolicy(t)
+	g := Gatherer{
+		Name:       "uname",
+		Cmd:        []string{"/usr/bin/nsenter", "-t", "1", "-n", "--", "uname", "-a"},
+		Namespaces: &Namespaces{Target: 1, Types: []string{"net"}},
+	}
+	exe, err := p.checkRun(g)
+	if err != nil {
+		t.Errorf("checkRun() = %v, wanted the wrapped command to be allowed", err)
+	}
+	uname, _ := resolve("uname")
+	if exe == nil || exe.path != uname || exe.index != 5 {
+		t.Errorf("checkRun() = %#v, wanted %v at index 5", exe, uname)
+	}
+	g.Cmd = []string{"/usr/bin/nsenter", "-t", "1", "-n", "--", "echo", "hi"}
+	if _, err := p.checkRun(g); err == nil {
+		t.Error("checkRun() = nil, wanted a policy violation for the wrapped command")
+	}
+}
+
+// hashOf returns the hex SHA-256 of the executable that runs for the name.
+func hashOf(t *testing.T, name string) string {
+	path, err := resolve(name)
+	rtx.Must(err, "failed to find %v", name)
+	f, sum, err := openSHA256(path)
+	rtx.Must(err, "failed to hash %v", name)
+	f.Close()
+	return sum
+}
+
+func TestPolicyRunsHashedFile(t *testing.T) {
+	defer func() { ActivePolicy = nil }()
+	ActivePolicy = testPolicy(t, hashOf(t, "uname"))
+
+	// The file that was hashed is run, under the name it was asked for.
+	exe, err := ActivePolicy.checkRun(Gatherer{Name: "uname", Cmd: []string{"uname", "-r"}})
+	rtx.Must(err, "uname -r is not allowed")
+	defer exe.close()
+	cmd := exec.Command("uname", "-r")
+	exe.apply(cmd, 0)
+	if cmd.Path != "/proc/self/fd/3" || cmd.Args[0] != "uname" || len(cmd.ExtraFiles) != 1 {
+		t.Errorf("apply() = %v %q with %d extra files, wanted the hashed file run as uname", cmd.Path, cmd.Args, len(cmd.ExtraFiles))
+	}
+
+	nodeinfo := &api.NodeInfoV1{}
+	if r := (Gatherer{Name: "uname", Cmd: []string{"uname", "-r"}}).Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if len(nodeinfo.Commands) != 1 || nodeinfo.Commands[0].Output == "" {
+		t.Errorf("Commands = %#v, wanted the output of uname -r", nodeinfo.Commands)
+	}
+}
+
+func TestPolicyHashInOtherMounts(t *testing.T) {
+	p := testPolicy(t, hashOf(t, "uname"))
+	g := Gatherer{Name: "uname", Cmd: []string{"uname", "-r"}, Namespaces: &Namespaces{Target: 1, Types: []string{"net"}}}
+	if err := p.CheckGatherer(g); err != nil {
+		t.Errorf("CheckGatherer() in another network namespace = %v, wanted nil", err)
+	}
+	g.Namespaces.Types = []string{"net", "mnt"}
+	if err := p.CheckGatherer(g); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("CheckGatherer() in another mount namespace = %v, wanted a policy violation", err)
+	}
+}
+
+func TestPolicyPackages(t *testing.T) {
+	defer func() { HostRoot = "" }()
+	dir := t.TempDir()
+	rtx.Must(ioutil.WriteFile(dir+"/rpm", []byte("#!/bin/sh\n"), 0o755), "failed to write rpm")
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	g := Gatherer{Name: "packages", Type: "packages", UseHostRoot: true}
+
+	// Only rpm's database is read with a command.
+	HostRoot = "../testdata/packages/debian"
+	if err := testPolicy(t).CheckGatherer(g); err != nil {
+		t.Errorf("CheckGatherer() on debian = %v, wanted nil", err)
+	}
+	HostRoot = "../testdata/packages/fedora"
+	if err := testPolicy(t).CheckGatherer(g); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("CheckGatherer() on fedora = %v, wanted a policy violation", err)
+	}
+	p := testPolicy(t)
+	p.Rules = append(p.Rules, PolicyRule{Path: dir + "/rpm", Args: []string{"-qa", "--queryformat", ".*", "--root", HostRoot}})
+	rtx.Must(p.Rules[len(p.Rules)-1].compile(), "failed to compile rule")
+	if err := p.CheckGatherer(g); err != nil {
+		t.Errorf("CheckGatherer() on fedora with rpm allowed = %v, wanted nil", err)
+	}
+}
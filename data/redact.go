@@ -0,0 +1,103 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// Supported redaction actions.
+const (
+	RedactReplace = "replace"
+	RedactDrop    = "drop"
+	RedactHash    = "hash"
+)
+
+// RedactionSalt is the per-deployment secret mixed into hashed matches, so that
+// hashes can be compared within a deployment but not reversed by guessing.
+// Hash redactions are refused while it is empty, as unsalted hashes of short
+// values like MAC addresses are easily brute-forced.
+var RedactionSalt []byte
+
+// Redaction is a rule that removes sensitive content from the output of a
+// gatherer before it is recorded. Every match of Pattern is replaced with
+// Replacement (which may refer to submatches like $1), replaced with a salted
+// hash of the match, or causes the whole line containing it to be dropped,
+// depending on Action.
+type Redaction struct {
+	Action      string
+	Pattern     string
+	Replacement string `json:",omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Compile checks the redaction for validity and prepares it for use. It must
+// be called on every redaction loaded from a config file.
+func (r *Redaction) Compile() error {
+	switch r.Action {
+	case RedactReplace, RedactDrop, RedactHash:
+	default:
+		return fmt.Errorf("unknown redaction action %q", r.Action)
+	}
+	if r.Pattern == "" {
+		return fmt.Errorf("redaction %q has no pattern", r.Action)
+	}
+	if r.Action == RedactHash && len(RedactionSalt) == 0 {
+		return fmt.Errorf("hash redaction of %q needs a redaction salt", r.Pattern)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// apply returns the output with the redaction applied, and the number of
+// matches that were redacted.
+func (r *Redaction) apply(output string) (string, int) {
+	if r.re == nil {
+		if err := r.Compile(); err != nil {
+			panic(err)
+		}
+	}
+	count := 0
+	switch r.Action {
+	case RedactDrop:
+		var kept []string
+		for _, line := range strings.Split(output, "\n") {
+			if r.re.MatchString(line) {
+				count++
+				continue
+			}
+			kept = append(kept, line)
+		}
+		return strings.Join(kept, "\n"), count
+	case RedactHash:
+		return r.re.ReplaceAllStringFunc(output, func(match string) string {
+			count++
+			mac := hmac.New(sha256.New, RedactionSalt)
+			mac.Write([]byte(match))
+			return hex.EncodeToString(mac.Sum(nil))[:16]
+		}), count
+	default:
+		count = len(r.re.FindAllStringIndex(output, -1))
+		return r.re.ReplaceAllString(output, r.Replacement), count
+	}
+}
+
+// redact applies every redaction of the gatherer to the output in order.
+func (g Gatherer) redact(output string) string {
+	for i := range g.Redactions {
+		var count int
+		output, count = g.Redactions[i].apply(output)
+		metrics.RedactionsApplied.WithLabelValues(g.Name, g.Redactions[i].Action).Add(float64(count))
+	}
+	return output
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const macPattern = `([0-9a-f]{2}:){5}[0-9a-f]{2}`
+
+func TestRedactionCompile(t *testing.T) {
+	RedactionSalt = []byte("salt")
+	defer func() { RedactionSalt = nil }()
+	tests := []struct {
+		r       Redaction
+		wantErr bool
+	}{
+		{r: Redaction{Action: RedactReplace, Pattern: "a", Replacement: "b"}},
+		{r: Redaction{Action: RedactDrop, Pattern: "a"}},
+		{r: Redaction{Action: RedactHash, Pattern: "a"}},
+		{r: Redaction{Action: "encrypt", Pattern: "a"}, wantErr: true},
+		{r: Redaction{Action: RedactDrop}, wantErr: true},
+		{r: Redaction{Action: RedactDrop, Pattern: "("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.r.Compile(); (err != nil) != tt.wantErr {
+			t.Errorf("%#v.Compile() = %v, wantErr %v", tt.r, err, tt.wantErr)
+		}
+	}
+
+	RedactionSalt = nil
+	r := Redaction{Action: RedactHash, Pattern: "a"}
+	if r.Compile() == nil {
+		t.Error("Compile() of a hash redaction without a salt = nil, wanted error")
+	}
+}
+
+func TestRedactionApply(t *testing.T) {
+	RedactionSalt = []byte("salt")
+	defer func() { RedactionSalt = nil }()
+	input := "10.0.0.1 lladdr 00:11:22:33:44:55 REACHABLE\n10.0.0.2 lladdr 66:77:88:99:aa:bb STALE\ntoken=hunter2"
+	tests := []struct {
+		name  string
+		r     Redaction
+		want  string
+		count int
+	}{
+		{
+			name:  "replace",
+			r:     Redaction{Action: RedactReplace, Pattern: `token=\S+`, Replacement: "token=REDACTED"},
+			want:  "10.0.0.1 lladdr 00:11:22:33:44:55 REACHABLE\n10.0.0.2 lladdr 66:77:88:99:aa:bb STALE\ntoken=REDACTED",
+			count: 1,
+		},
+		{
+			name:  "drop",
+			r:     Redaction{Action: RedactDrop, Pattern: "STALE"},
+			want:  "10.0.0.1 lladdr 00:11:22:33:44:55 REACHABLE\ntoken=hunter2",
+			count: 1,
+		},
+		{
+			name:  "hash",
+			r:     Redaction{Action: RedactHash, Pattern: macPattern},
+			want:  "10.0.0.1 lladdr c1ee9a9e38be346b REACHABLE\n10.0.0.2 lladdr 8ca3e4bc103b0d43 STALE\ntoken=hunter2",
+			count: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := tt.r.apply(input)
+			if got != tt.want || count != tt.count {
+				t.Errorf("apply() = %q, %d; wanted %q, %d", got, count, tt.want, tt.count)
+			}
+		})
+	}
+}
+
+func TestRedactionHashDependsOnSalt(t *testing.T) {
+	defer func() { RedactionSalt = nil }()
+	r := Redaction{Action: RedactHash, Pattern: macPattern}
+	RedactionSalt = []byte("one")
+	a, _ := r.apply("00:11:22:33:44:55")
+	RedactionSalt = []byte("two")
+	b, _ := r.apply("00:11:22:33:44:55")
+	if a == b {
+		t.Errorf("hashes with different salts should differ, got %q twice", a)
+	}
+}
+
+func TestRedactedOutputNeverReachesDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRedactedOutputNeverReachesDisk")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	RedactionSalt = []byte("salt")
+	defer func() { RedactionSalt = nil }()
+
+	// The secrets are read from a file so that they do not appear in the
+	// command line, which is recorded verbatim.
+	secrets := []string{"00:11:22:33:44:55", "hunter2", "serial123"}
+	input := "mac 00:11:22:33:44:55 password hunter2\nserial serial123\nkept\n"
+	rtx.Must(ioutil.WriteFile(dir+"/input.txt", []byte(input), 0o666), "failed to write input")
+	g := Gatherer{
+		Name: "secrets",
+		Cmd:  []string{"cat", dir + "/input.txt"},
+		Redactions: []Redaction{
+			{Action: RedactHash, Pattern: macPattern},
+			{Action: RedactReplace, Pattern: `password \S+`, Replacement: "password XXX"},
+			{Action: RedactDrop, Pattern: "^serial"},
+		},
+	}
+	before := testutil.ToFloat64(metrics.RedactionsApplied.WithLabelValues("secrets", RedactHash))
+	nodeinfo := api.NodeInfoV1{}
+	g.Gather(true, &nodeinfo)
+	if got := testutil.ToFloat64(metrics.RedactionsApplied.WithLabelValues("secrets", RedactHash)) - before; got != 1 {
+		t.Errorf("hash redactions = %v, wanted 1", got)
+	}
+
+	for _, layout := range Layouts {
+		result, err := Save(dir, "nodeinfo1", layout, CompressionNone, nodeinfo)
+		rtx.Must(err, "failed to save")
+		contents, err := os.ReadFile(result.Filename)
+		rtx.Must(err, "failed to read saved file")
+		for _, secret := range secrets {
+			if strings.Contains(string(contents), secret) {
+				t.Errorf("%v layout: %q reached disk: %s", layout, secret, contents)
+			}
+		}
+		if !strings.Contains(string(contents), "kept") {
+			t.Errorf("%v layout: unredacted output is missing: %s", layout, contents)
+		}
+	}
+}
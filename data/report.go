@@ -0,0 +1,78 @@
+package data
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Failed returns the number of results that have an error.
+func Failed(results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteReport writes a table with a row for every result.
+func WriteReport(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tDURATION\tBYTES\tERROR")
+	for _, r := range results {
+		status, msg := "ok", ""
+		if r.Err != nil {
+			status, msg = "failed", r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%d\t%s\n", r.Name, status, r.Duration.Round(time.Millisecond), r.Bytes, msg)
+	}
+	return tw.Flush()
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// WriteJUnit writes the results as a JUnit XML test suite with the given
+// name, with one test case per result, so that CI systems can display them.
+func WriteJUnit(w io.Writer, suite string, results []Result) error {
+	ts := junitTestSuite{Name: suite, Tests: len(results), Failures: Failed(results)}
+	for _, r := range results {
+		tc := junitTestCase{Name: r.Name, Classname: suite, Time: r.Duration.Seconds()}
+		if r.Err != nil {
+			tc.Failure = &junitFailure{Message: r.Err.Error()}
+		}
+		ts.Time += tc.Time
+		ts.TestCases = append(ts.TestCases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(ts); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
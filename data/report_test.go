@@ -0,0 +1,50 @@
+package data
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-lab/go/rtx"
+)
+
+var reportResults = []Result{
+	{Name: "uname", Duration: 3 * time.Millisecond, Bytes: 100},
+	{Name: "lshw", Duration: 2 * time.Second, Err: errors.New("exec: \"lshw\": executable file not found in $PATH")},
+}
+
+func TestWriteReport(t *testing.T) {
+	var buf bytes.Buffer
+	rtx.Must(WriteReport(&buf, reportResults), "failed to write report")
+	want := "NAME   STATUS  DURATION  BYTES  ERROR\n" +
+		"uname  ok      3ms       100    \n" +
+		"lshw   failed  2s        0      exec: \"lshw\": executable file not found in $PATH\n"
+	if buf.String() != want {
+		t.Errorf("WriteReport() =\n%s\nwanted\n%s", buf.String(), want)
+	}
+	if got := Failed(reportResults); got != 1 {
+		t.Errorf("Failed() = %d, wanted 1", got)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	rtx.Must(WriteJUnit(&buf, "nodeinfo-smoketest", reportResults), "failed to write JUnit")
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("WriteJUnit() = %q, wanted an XML header", buf.String())
+	}
+	var got junitTestSuite
+	rtx.Must(xml.Unmarshal(buf.Bytes(), &got), "failed to parse JUnit")
+	if got.Name != "nodeinfo-smoketest" || got.Tests != 2 || got.Failures != 1 || len(got.TestCases) != 2 {
+		t.Errorf("WriteJUnit() = %#v, wanted 2 tests with 1 failure", got)
+	}
+	if got.TestCases[0].Failure != nil || got.TestCases[1].Failure == nil {
+		t.Errorf("WriteJUnit() test cases = %#v, wanted only lshw to fail", got.TestCases)
+	}
+	if got.TestCases[1].Time != 2 {
+		t.Errorf("lshw time = %v, wanted 2", got.TestCases[1].Time)
+	}
+}
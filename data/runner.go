@@ -0,0 +1,105 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// Runner produces the raw output of a gatherer's command, along with the
+// resources the command used if it was run.
+type Runner interface {
+	Run(g Gatherer) ([]byte, *api.Usage, error)
+}
+
+// CommandRunner is the Runner used by Gather. It runs commands on the local
+// machine unless it is replaced with a replaying or recording Runner.
+var CommandRunner Runner = ExecRunner{}
+
+// ExecRunner runs the command of the gatherer on the local machine.
+type ExecRunner struct{}
+
+// Run runs the command and returns its standard output and resource usage.
+// The command is checked against ActivePolicy first, in case it changed since
+// the config was loaded.
+func (ExecRunner) Run(g Gatherer) ([]byte, *api.Usage, error) {
+	exe, err := ActivePolicy.checkRun(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer exe.close()
+	cmd, err := g.Limits.command(g.Cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	exe.apply(cmd, len(cmd.Args)-len(g.Cmd))
+	out, err := cmd.Output()
+	return out, usage(cmd.ProcessState), err
+}
+
+// usage returns the resources used by an exited process and the children it
+// waited for, or nil if the process never started.
+func usage(state *os.ProcessState) *api.Usage {
+	if state == nil {
+		return nil
+	}
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	return &api.Usage{
+		UserSeconds:   state.UserTime().Seconds(),
+		SystemSeconds: state.SystemTime().Seconds(),
+		// Linux reports the maximum resident set size in kilobytes.
+		MaxRSS:    int64(rusage.Maxrss) * 1024,
+		InBlocks:  int64(rusage.Inblock),
+		OutBlocks: int64(rusage.Oublock),
+	}
+}
+
+// fixture returns the name of the file holding the output of a gatherer
+// within a fixtures directory. Slashes in the name, e.g. from the item of a
+// ForEach gatherer, are replaced so that it is a single file.
+func fixture(dir string, g Gatherer) string {
+	return filepath.Join(dir, strings.ReplaceAll(g.Name, "/", "_")+".txt")
+}
+
+// ReplayRunner reads previously recorded outputs from Dir instead of running
+// commands. The output of every gatherer is in a file named after the
+// gatherer, e.g. testdata/fixtures/<host>/<name>.txt. Built-in collectors
+// read files instead, so they are neither recorded nor replayed, and are only
+// valid while replaying if they read a copy of the host under HostRoot.
+type ReplayRunner struct {
+	Dir string
+}
+
+// Run returns the recorded output of the gatherer. Nothing is run, so there
+// is no resource usage.
+func (r ReplayRunner) Run(g Gatherer) ([]byte, *api.Usage, error) {
+	out, err := os.ReadFile(fixture(r.Dir, g))
+	return out, nil, err
+}
+
+// RecordingRunner runs commands with Runner and saves their outputs into Dir
+// in the layout read by ReplayRunner. Outputs are saved before redaction, so
+// the directory and files are only readable by their owner. The fixtures of
+// ForEach gatherers are named after their unredacted items.
+type RecordingRunner struct {
+	Runner Runner
+	Dir    string
+}
+
+// Run runs the command and records its output if it succeeded.
+func (r RecordingRunner) Run(g Gatherer) ([]byte, *api.Usage, error) {
+	out, u, err := r.Runner.Run(g)
+	if err != nil {
+		return out, u, err
+	}
+	if err := os.MkdirAll(r.Dir, 0o700); err != nil {
+		return out, u, err
+	}
+	return out, u, os.WriteFile(fixture(r.Dir, g), out, 0o600)
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// withoutUsage returns a copy of the commands without their resource usage,
+// which differs from run to run.
+func withoutUsage(cmds []api.CmdOut) []api.CmdOut {
+	var stripped []api.CmdOut
+	for _, cmd := range cmds {
+		cmd.Usage = nil
+		stripped = append(stripped, cmd)
+	}
+	return stripped
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRecordAndReplay")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	defer func() { CommandRunner = ExecRunner{} }()
+
+	g := Gatherer{Name: "echo", Cmd: []string{"echo", "recorded"}}
+	CommandRunner = RecordingRunner{Runner: ExecRunner{}, Dir: dir + "/host"}
+	recorded := api.NodeInfoV1{}
+	g.Gather(true, &recorded)
+	contents, err := os.ReadFile(dir + "/host/echo.txt")
+	rtx.Must(err, "the output was not recorded")
+	if string(contents) != "recorded\n" {
+		t.Errorf("recorded %q, wanted %q", contents, "recorded\n")
+	}
+	info, err := os.Stat(dir + "/host/echo.txt")
+	rtx.Must(err, "failed to stat the recording")
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("recording mode = %v, wanted -rw-------", info.Mode().Perm())
+	}
+
+	// The replayed command would print something else if it were run.
+	CommandRunner = ReplayRunner{Dir: dir + "/host"}
+	replayed := api.NodeInfoV1{}
+	Gatherer{Name: "echo", Cmd: []string{"echo", "live"}}.Gather(true, &replayed)
+	if len(replayed.Commands) != 1 || replayed.Commands[0].Output != "recorded" {
+		t.Errorf("replayed = %#v, wanted the recorded output", replayed)
+	}
+	if replayed.Commands[0].CommandLine != "echo live" {
+		t.Errorf("replayed CommandLine = %q, wanted the configured command", replayed.Commands[0].CommandLine)
+	}
+}
+
+func TestReplayMissingFixture(t *testing.T) {
+	defer func() { CommandRunner = ExecRunner{} }()
+	CommandRunner = ReplayRunner{Dir: "/this/dir/does/not/exist"}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("recover() = nil, expected panic")
+		}
+	}()
+	Gatherer{Name: "missing", Cmd: []string{"true"}}.Gather(true, &api.NodeInfoV1{})
+}
+
+func TestRecordFailedCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRecordFailedCommand")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	r := RecordingRunner{Runner: ExecRunner{}, Dir: dir}
+	if _, _, err := r.Run(Gatherer{Name: "false", Cmd: []string{"false"}}); err == nil {
+		t.Error("Run() = nil, wanted error")
+	}
+	if _, err := os.Stat(dir + "/false.txt"); err == nil {
+		t.Error("the output of a failed command should not be recorded")
+	}
+}
+
+func TestExecRunnerUsage(t *testing.T) {
+	defer func() { CommandRunner = ExecRunner{} }()
+	// Reading a file through a pipe uses some memory and CPU in the children
+	// of the shell, which are included in its usage.
+	g := Gatherer{Name: "usage_test", Cmd: []string{"sh", "-c", "head -c 20000000 /dev/zero | wc -c"}}
+	nodeinfo := &api.NodeInfoV1{}
+	before := testutil.CollectAndCount(metrics.GatherMaxRSS)
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	u := nodeinfo.Commands[0].Usage
+	if u == nil || u.MaxRSS <= 0 || u.UserSeconds < 0 || u.SystemSeconds < 0 {
+		t.Errorf("Usage = %#v, wanted the resources used by the command", u)
+	}
+	if got := testutil.CollectAndCount(metrics.GatherMaxRSS) - before; got != 1 {
+		t.Errorf("GatherMaxRSS has %d new series, wanted 1 for the gatherer", got)
+	}
+
+	// Replayed outputs weren't run, so they have no usage.
+	dir := t.TempDir()
+	rtx.Must(ioutil.WriteFile(dir+"/usage_test.txt", []byte("20000000\n"), 0o666), "failed to write fixture")
+	CommandRunner = ReplayRunner{Dir: dir}
+	nodeinfo = &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() while replaying = %v, wanted nil", r.Err)
+	}
+	if u := nodeinfo.Commands[0].Usage; u != nil {
+		t.Errorf("Usage = %#v, wanted nil for a replayed output", u)
+	}
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// Sink is a destination for gathered data.
+type Sink interface {
+	// Name identifies the sink in logs and metrics, like the -sink flag value
+	// it was created from.
+	Name() string
+	// Write sends a single NodeInfo document to the sink.
+	Write(nodeinfo api.NodeInfoV1) error
+}
+
+// HTTPTimeout bounds every request made by an HTTP sink, so that a hung
+// collector cannot stall the gather loop.
+var HTTPTimeout = 30 * time.Second
+
+// NewSink creates the Sink described by a -sink flag value. Supported values
+// are "spool" (which returns the passed-in spool sink), "stdout",
+// "jsonl:<filename>", and any http:// or https:// URL.
+func NewSink(spec string, spool *SpoolSink) (Sink, error) {
+	switch {
+	case spec == "spool":
+		return spool, nil
+	case spec == "stdout":
+		return &WriterSink{W: os.Stdout}, nil
+	case strings.HasPrefix(spec, "jsonl:") && len(spec) > len("jsonl:"):
+		return &JSONLSink{Filename: strings.TrimPrefix(spec, "jsonl:")}, nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return &HTTPSink{URL: spec, Client: &http.Client{Timeout: HTTPTimeout}}, nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", spec)
+}
+
+// WriteAll writes the data to every sink, even if some of them fail. Errors
+// are counted per sink, and the first one (if any) is returned.
+func WriteAll(sinks []Sink, nodeinfo api.NodeInfoV1) error {
+	var first error
+	for _, s := range sinks {
+		if err := s.Write(nodeinfo); err != nil {
+			log.Printf("failed to write to %v sink (error: %v)\n", s.Name(), err)
+			metrics.SinkErrors.WithLabelValues(s.Name()).Inc()
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// SpoolSink saves data into the local spool directory layout expected by the
+// M-Lab uploaders. It is the default sink.
+type SpoolSink struct {
+	Datadir     string
+	Datatype    string
+	Layout      string
+	Compression string
+}
+
+// Name returns "spool".
+func (s *SpoolSink) Name() string {
+	return "spool"
+}
+
+// Write saves the data to a new file in the spool directory.
+func (s *SpoolSink) Write(nodeinfo api.NodeInfoV1) error {
+	_, err := Save(s.Datadir, s.Datatype, s.Layout, s.Compression, nodeinfo)
+	return err
+}
+
+// WriterSink writes every document as a single line of JSON to W.
+type WriterSink struct {
+	W io.Writer
+}
+
+// Name returns "stdout", as that is the only writer exposed by NewSink.
+func (s *WriterSink) Name() string {
+	return "stdout"
+}
+
+// Write writes the data as a line of JSON.
+func (s *WriterSink) Write(nodeinfo api.NodeInfoV1) error {
+	return json.NewEncoder(s.W).Encode(nodeinfo)
+}
+
+// JSONLSink appends every document as a single line of JSON to a file.
+type JSONLSink struct {
+	Filename string
+}
+
+// Name returns "jsonl:" followed by the filename.
+func (s *JSONLSink) Name() string {
+	return "jsonl:" + s.Filename
+}
+
+// Write appends the data as a line of JSON, creating the file if necessary.
+func (s *JSONLSink) Write(nodeinfo api.NodeInfoV1) error {
+	f, err := os.OpenFile(s.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(nodeinfo); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPSink POSTs every document as JSON to a collector URL.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name returns the URL without any credentials or query, as it is exported in
+// metrics.
+func (s *HTTPSink) Name() string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return "http"
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+// Write POSTs the data and returns an error unless the collector responds
+// with a 2xx status.
+func (s *HTTPSink) Write(nodeinfo api.NodeInfoV1) error {
+	b, err := json.Marshal(nodeinfo)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector returned %v", resp.Status)
+	}
+	return nil
+}
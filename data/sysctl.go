@@ -0,0 +1,98 @@
+package data
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// sysctlCollector reads kernel parameters from /proc/sys. Keys use the dotted
+// form of sysctl(8), and the gatherer's Include and Exclude glob patterns
+// (e.g. "net.ipv4.tcp_*") select which keys are recorded.
+type sysctlCollector struct{}
+
+func (sysctlCollector) validate(g Gatherer) error {
+	if len(g.Include) == 0 {
+		return errors.New("sysctl gatherer has no Include patterns")
+	}
+	return validatePatterns(g)
+}
+
+// matches reports whether the key matches any of the glob patterns.
+func matches(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sysctlRoot returns the directory under /proc/sys holding every key that may
+// match the pattern, i.e. the part of it before the first wildcard.
+func sysctlRoot(pattern string) string {
+	literal := pattern
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		literal = pattern[:i]
+	}
+	if i := strings.LastIndex(literal, "."); i >= 0 {
+		return strings.ReplaceAll(literal[:i], ".", "/")
+	}
+	return ""
+}
+
+func (sysctlCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	procSys := g.path("/proc/sys")
+	size := 0
+	values := make(map[string]string)
+	for _, s := range nodeinfo.Sysctl {
+		values[s.Key] = s.Value
+	}
+	for _, pattern := range g.Include {
+		root := filepath.Join(procSys, sysctlRoot(pattern))
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == root && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(procSys, p)
+			if err != nil {
+				return err
+			}
+			key := strings.ReplaceAll(rel, "/", ".")
+			if !matches(g.Include, key) || matches(g.Exclude, key) {
+				return nil
+			}
+			// Some parameters are write-only or fail to read, so they are
+			// skipped rather than failing the whole collection.
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			values[key] = strings.TrimSuffix(string(b), "\n")
+			size += len(key) + len(values[key])
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	nodeinfo.Sysctl = nodeinfo.Sysctl[:0]
+	for key, value := range values {
+		nodeinfo.Sysctl = append(nodeinfo.Sysctl, api.Sysctl{Key: key, Value: value})
+	}
+	sort.Slice(nodeinfo.Sysctl, func(i, j int) bool { return nodeinfo.Sysctl[i].Key < nodeinfo.Sysctl[j].Key })
+	return size, nil
+}
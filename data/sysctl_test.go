@@ -0,0 +1,20 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestSysctlRoot(t *testing.T) {
+	tests := map[string]string{
+		"net.ipv4.tcp_*":   "net/ipv4",
+		"net.core.*":       "net/core",
+		"kernel.hostname":  "kernel",
+		"*":                "",
+		"net.ipv4.conf.*.": "net/ipv4/conf",
+	}
+	for pattern, want := range tests {
+		if got := sysctlRoot(pattern); got != want {
+			t.Errorf("sysctlRoot(%q) = %q, wanted %q", pattern, got, want)
+		}
+	}
+}
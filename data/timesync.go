@@ -0,0 +1,66 @@
+package data
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// timesyncCollector records the state of the kernel clock from adjtimex(2),
+// along with the clock source it counts time with.
+type timesyncCollector struct{}
+
+func (timesyncCollector) validate(g Gatherer) error {
+	return nil
+}
+
+// adjtimex reads the kernel clock. It is replaced in tests.
+var adjtimex = syscall.Adjtimex
+
+// Constants from linux/timex.h.
+const (
+	staUnsync = 0x0040
+	staNano   = 0x2000
+	timeError = 5
+)
+
+// clockStates names the return values of adjtimex(2).
+var clockStates = []string{"ok", "insert", "delete", "oop", "wait", "error"}
+
+func (timesyncCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	// Modes is zero, so this only reads the clock.
+	var tx syscall.Timex
+	state, err := adjtimex(&tx)
+	if err != nil {
+		return 0, err
+	}
+	ts := &api.TimeSync{
+		Synchronized: state != timeError && tx.Status&staUnsync == 0,
+		Status:       int64(tx.Status),
+		Offset:       int64(tx.Offset),
+		Frequency:    float64(tx.Freq) / 65536,
+		MaxError:     int64(tx.Maxerror),
+		EstError:     int64(tx.Esterror),
+	}
+	if state >= 0 && state < len(clockStates) {
+		ts.State = clockStates[state]
+	}
+	// The offset is in microseconds unless the clock is in nanosecond mode.
+	if tx.Status&staNano == 0 {
+		ts.Offset *= 1000
+	}
+	clocksource := g.path("/sys/devices/system/clocksource/clocksource0")
+	ts.ClockSource = readSysfs(filepath.Join(clocksource, "current_clocksource"))
+	ts.AvailableClockSources = strings.Fields(readSysfs(filepath.Join(clocksource, "available_clocksource")))
+
+	if ts.Synchronized {
+		metrics.TimeSynchronized.WithLabelValues(g.Name).Set(1)
+	} else {
+		metrics.TimeSynchronized.WithLabelValues(g.Name).Set(0)
+	}
+	nodeinfo.TimeSync = ts
+	return len(ts.State) + len(ts.ClockSource), nil
+}
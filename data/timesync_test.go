@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTimesyncCollector(t *testing.T) {
+	defer func() { adjtimex = syscall.Adjtimex }()
+	tests := []struct {
+		name  string
+		state int
+		tx    syscall.Timex
+		want  *api.TimeSync
+	}{
+		{
+			name:  "synchronized",
+			state: 0,
+			tx:    syscall.Timex{Status: 0x2001, Offset: -12345, Freq: -1310720, Maxerror: 5000, Esterror: 20},
+			want: &api.TimeSync{
+				State:        "ok",
+				Synchronized: true,
+				Status:       0x2001,
+				Offset:       -12345,
+				Frequency:    -20,
+				MaxError:     5000,
+				EstError:     20,
+			},
+		},
+		{
+			name:  "unsynchronized",
+			state: 5,
+			tx:    syscall.Timex{Status: 0x0041, Offset: 250, Maxerror: 16000000, Esterror: 16000000},
+			want: &api.TimeSync{
+				State:    "error",
+				Status:   0x0041,
+				Offset:   250000,
+				MaxError: 16000000,
+				EstError: 16000000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		adjtimex = func(tx *syscall.Timex) (int, error) {
+			*tx = tt.tx
+			return tt.state, nil
+		}
+		nodeinfo := gatherTestdata(t, Gatherer{Name: "timesync", Type: "timesync"})
+		tt.want.ClockSource = "tsc"
+		tt.want.AvailableClockSources = []string{"tsc", "hpet", "acpi_pm"}
+		if !reflect.DeepEqual(nodeinfo.TimeSync, tt.want) {
+			t.Errorf("%v: TimeSync = %#v, wanted %#v", tt.name, nodeinfo.TimeSync, tt.want)
+		}
+		wantGauge := 0.0
+		if tt.want.Synchronized {
+			wantGauge = 1
+		}
+		if got := testutil.ToFloat64(metrics.TimeSynchronized.WithLabelValues("timesync")); got != wantGauge {
+			t.Errorf("%v: TimeSynchronized = %v, wanted %v", tt.name, got, wantGauge)
+		}
+	}
+}
+
+func TestTimesyncCollectorError(t *testing.T) {
+	defer func() { adjtimex = syscall.Adjtimex }()
+	adjtimex = func(*syscall.Timex) (int, error) { return -1, errors.New("operation not permitted") }
+	g := Gatherer{Name: "timesync_error", Type: "timesync"}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error")
+	}
+	// An unknown clock state must not look like an unsynchronized clock.
+	if metrics.TimeSynchronized.DeleteLabelValues(g.Name) {
+		t.Error("TimeSynchronized was exported without a clock state")
+	}
+}
+
+func TestTimesyncCollectorLocal(t *testing.T) {
+	// The real clock is in whatever state it is in, but reading it must work.
+	g := Gatherer{Name: "timesync", Type: "timesync"}
+	nodeinfo := &api.NodeInfoV1{}
+	if r := g.Gather(false, nodeinfo); r.Err != nil {
+		t.Fatalf("Gather() = %v, wanted nil", r.Err)
+	}
+	if nodeinfo.TimeSync == nil || nodeinfo.TimeSync.State == "" {
+		t.Errorf("TimeSync = %#v, wanted a clock state", nodeinfo.TimeSync)
+	}
+}
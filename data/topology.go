@@ -0,0 +1,163 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// topologyCollector records the CPUs and memory of the node in a single
+// api.Topology, read from /proc/cpuinfo, /proc/meminfo and
+// /sys/devices/system.
+type topologyCollector struct{}
+
+func (topologyCollector) validate(g Gatherer) error {
+	return nil
+}
+
+// parseCPUInfo fills in the model, socket, core and thread counts of the
+// topology from /proc/cpuinfo, which has one block of "key : value" lines per
+// logical CPU. Every CPU is assumed to have the same model.
+func parseCPUInfo(filename string, t *api.Topology) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sockets := make(map[string]bool)
+	cores := make(map[string]bool)
+	var socket string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			t.Threads++
+		case "vendor_id":
+			t.Vendor = value
+		case "model name":
+			t.Model = value
+		case "cpu family":
+			t.Family, _ = strconv.Atoi(value)
+		case "model":
+			t.ModelNumber, _ = strconv.Atoi(value)
+		case "stepping":
+			t.Stepping, _ = strconv.Atoi(value)
+		case "microcode":
+			t.Microcode = value
+		case "physical id":
+			socket = value
+			sockets[socket] = true
+		case "core id":
+			cores[socket+"/"+value] = true
+		}
+	}
+	t.Sockets, t.Cores = len(sockets), len(cores)
+	return scanner.Err()
+}
+
+// parseMeminfo returns the values of the passed-in keys of a meminfo file in
+// bytes. Lines look like "MemTotal: 16337612 kB", optionally prefixed by
+// "Node 0" in the per-node files.
+func parseMeminfo(filename string, keys ...string) (map[string]int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[0] == "Node" {
+			fields = fields[2:]
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		key := strings.TrimSuffix(fields[0], ":")
+		for _, k := range keys {
+			if k != key {
+				continue
+			}
+			v, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			if len(fields) > 2 && fields[2] == "kB" {
+				v *= 1024
+			}
+			values[key] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+func (topologyCollector) collect(g Gatherer, nodeinfo *api.NodeInfoV1) (int, error) {
+	t := &api.Topology{}
+	if err := parseCPUInfo(g.path("/proc/cpuinfo"), t); err != nil {
+		return 0, err
+	}
+	mem, err := parseMeminfo(g.path("/proc/meminfo"), "MemTotal", "SwapTotal", "HugePages_Total", "Hugepagesize")
+	if err != nil {
+		return 0, err
+	}
+	t.MemoryTotal, t.SwapTotal = mem["MemTotal"], mem["SwapTotal"]
+	t.HugePages, t.HugePageSize = mem["HugePages_Total"], mem["Hugepagesize"]
+
+	cpuDir := g.path("/sys/devices/system/cpu")
+	t.Online = readSysfs(filepath.Join(cpuDir, "online"))
+	cpus, _ := filepath.Glob(filepath.Join(cpuDir, "cpu[0-9]*"))
+	governors := make(map[string]bool)
+	for _, cpu := range cpus {
+		if governor := readSysfs(filepath.Join(cpu, "cpufreq", "scaling_governor")); governor != "" {
+			governors[governor] = true
+		}
+		if freq, err := strconv.ParseInt(readSysfs(filepath.Join(cpu, "cpufreq", "cpuinfo_max_freq")), 10, 64); err == nil && freq > t.MaxFrequency {
+			t.MaxFrequency = freq
+		}
+	}
+	for governor := range governors {
+		t.Governors = append(t.Governors, governor)
+	}
+	sort.Strings(t.Governors)
+
+	// Older kernels have no vulnerabilities directory, so it may be missing.
+	vulnerabilities, _ := os.ReadDir(filepath.Join(cpuDir, "vulnerabilities"))
+	for _, v := range vulnerabilities {
+		t.Vulnerabilities = append(t.Vulnerabilities, api.Vulnerability{
+			Name:   v.Name(),
+			Status: readSysfs(filepath.Join(cpuDir, "vulnerabilities", v.Name())),
+		})
+	}
+
+	nodes, _ := filepath.Glob(filepath.Join(g.path("/sys/devices/system/node"), "node[0-9]*"))
+	for _, node := range nodes {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(node), "node"))
+		if err != nil {
+			continue
+		}
+		numa := api.NUMANode{ID: id, CPUs: readSysfs(filepath.Join(node, "cpulist"))}
+		if mem, err := parseMeminfo(filepath.Join(node, "meminfo"), "MemTotal"); err == nil {
+			numa.MemoryTotal = mem["MemTotal"]
+		}
+		t.NUMANodes = append(t.NUMANodes, numa)
+	}
+	sort.Slice(t.NUMANodes, func(i, j int) bool { return t.NUMANodes[i].ID < t.NUMANodes[j].ID })
+
+	nodeinfo.Topology = t
+	b, err := json.Marshal(t)
+	return len(b), err
+}
@@ -0,0 +1,16 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestTopologyCollectorMissing(t *testing.T) {
+	HostRoot = t.TempDir()
+	defer func() { HostRoot = "" }()
+	g := Gatherer{Name: "topology", Type: "topology", UseHostRoot: true}
+	if r := g.Gather(false, &api.NodeInfoV1{}); r.Err == nil {
+		t.Error("Gather() = nil, wanted an error for a missing /proc/cpuinfo")
+	}
+}
@@ -0,0 +1,265 @@
+// Package diff compares NodeInfo documents, so that operators can see what
+// changed on a node between two runs.
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// Statuses of a gatherer in a Change.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change describes how the output of a single gatherer differs between two
+// documents. Outputs that are JSON in both documents are compared field by
+// field, and all other outputs are compared line by line.
+type Change struct {
+	Name    string
+	Status  string
+	Unified string        `json:",omitempty"`
+	Fields  []FieldChange `json:",omitempty"`
+}
+
+// FieldChange describes a single value that differs between two parsed
+// outputs. Old is nil for added fields and New is nil for removed ones.
+type FieldChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// Documents returns every gatherer whose output differs between a and b, in
+// the order they appear in b followed by the ones that only appear in a.
+// Gatherers that appear more than once in a document are told apart by the
+// order in which they appear. Changes to the structured sections of built-in
+// collectors follow, sorted by section name.
+func Documents(a, b api.NodeInfoV1) []Change {
+	aOut, aNames := outputs(a)
+	bOut, bNames := outputs(b)
+	var changes []Change
+	for _, name := range bNames {
+		old, ok := aOut[name]
+		switch {
+		case !ok:
+			changes = append(changes, compare(name, Added, "", bOut[name]))
+		case old != bOut[name]:
+			changes = append(changes, compare(name, Changed, old, bOut[name]))
+		}
+	}
+	for _, name := range aNames {
+		if _, ok := bOut[name]; !ok {
+			changes = append(changes, compare(name, Removed, aOut[name], ""))
+		}
+	}
+	aSections, bSections := sections(a), sections(b)
+	for _, name := range sortedKeys(aSections, bSections) {
+		before, inA := aSections[name]
+		after, inB := bSections[name]
+		switch {
+		case !inA:
+			changes = append(changes, Change{Name: name, Status: Added, Fields: Fields(nil, after)})
+		case !inB:
+			changes = append(changes, Change{Name: name, Status: Removed, Fields: Fields(before, nil)})
+		default:
+			if fields := Fields(before, after); len(fields) > 0 {
+				changes = append(changes, Change{Name: name, Status: Changed, Fields: fields})
+			}
+		}
+	}
+	return changes
+}
+
+// sections returns the decoded JSON of every structured section of the
+// document, keyed by its JSON name.
+func sections(nodeinfo api.NodeInfoV1) map[string]interface{} {
+	var all map[string]interface{}
+	b, _ := json.Marshal(nodeinfo)
+	json.Unmarshal(b, &all)
+	delete(all, "commands")
+	return all
+}
+
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Hashes returns the SHA-256 of the output of every gatherer and of every
+// structured section, keyed by the names used in Changes.
+func Hashes(nodeinfo api.NodeInfoV1) map[string]string {
+	hashes := make(map[string]string)
+	out, _ := outputs(nodeinfo)
+	for name, output := range out {
+		hashes[name] = hash([]byte(output))
+	}
+	for name, v := range sections(nodeinfo) {
+		b, _ := json.Marshal(v)
+		hashes[name] = hash(b)
+	}
+	return hashes
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// outputs returns the output of every command keyed by a unique name, along
+// with the names in document order. Commands run once per item are named
+// after their item, e.g. "ethtool[eth0]".
+func outputs(nodeinfo api.NodeInfoV1) (map[string]string, []string) {
+	out := make(map[string]string)
+	var names []string
+	seen := make(map[string]int)
+	for _, cmd := range nodeinfo.Commands {
+		key := cmd.Name
+		if cmd.Item != "" {
+			key = fmt.Sprintf("%s[%s]", cmd.Name, cmd.Item)
+		}
+		name := key
+		if seen[key] > 0 {
+			name = fmt.Sprintf("%s#%d", key, seen[key]+1)
+		}
+		seen[key]++
+		out[name] = cmd.Output
+		names = append(names, name)
+	}
+	return out, names
+}
+
+func compare(name, status, before, after string) Change {
+	c := Change{Name: name, Status: status}
+	var oldValue, newValue interface{}
+	if status == Changed && parse(before, &oldValue) && parse(after, &newValue) {
+		c.Fields = Fields(oldValue, newValue)
+		return c
+	}
+	c.Unified = Unified("a/"+name, "b/"+name, before, after)
+	return c
+}
+
+// parse reports whether the output is a JSON object or array.
+func parse(output string, v *interface{}) bool {
+	if json.Unmarshal([]byte(output), v) != nil {
+		return false
+	}
+	switch (*v).(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// Fields returns every leaf value that differs between two parsed JSON values,
+// sorted by path. A nil value has no leaves.
+func Fields(before, after interface{}) []FieldChange {
+	oldLeaves := make(map[string]interface{})
+	newLeaves := make(map[string]interface{})
+	if before != nil {
+		flatten("", before, oldLeaves)
+	}
+	if after != nil {
+		flatten("", after, newLeaves)
+	}
+	var changes []FieldChange
+	for path, o := range oldLeaves {
+		n, ok := newLeaves[path]
+		if !ok || fmt.Sprint(n) != fmt.Sprint(o) {
+			changes = append(changes, FieldChange{Path: path, Old: o, New: n})
+		}
+	}
+	for path, n := range newLeaves {
+		if _, ok := oldLeaves[path]; !ok {
+			changes = append(changes, FieldChange{Path: path, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func flatten(prefix string, v interface{}, leaves map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flatten(path, child, leaves)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, leaves)
+		}
+	default:
+		leaves[prefix] = v
+	}
+}
+
+// Compact returns the unified diff or field changes of the change as text.
+func (c Change) Compact() string {
+	if c.Unified != "" {
+		return c.Unified
+	}
+	var sb strings.Builder
+	for _, f := range c.Fields {
+		switch {
+		case f.Old == nil:
+			fmt.Fprintf(&sb, "+ %s: %v\n", f.Path, f.New)
+		case f.New == nil:
+			fmt.Fprintf(&sb, "- %s: %v\n", f.Path, f.Old)
+		default:
+			fmt.Fprintf(&sb, "~ %s: %v -> %v\n", f.Path, f.Old, f.New)
+		}
+	}
+	return sb.String()
+}
+
+// WriteText writes the changes in a human-readable form.
+func WriteText(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintf(w, "=== %s (%s)\n%s", c.Name, c.Status, c.Compact()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the changes as indented JSON for use by other programs.
+func WriteJSON(w io.Writer, changes []Change) error {
+	if changes == nil {
+		changes = []Change{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(changes)
+}
+
+// lines splits text into lines, treating the empty string as no lines.
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,244 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "same",
+			a:    "a\nb",
+			b:    "a\nb",
+			want: "",
+		},
+		{
+			name: "changed-line",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9",
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate-hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "added",
+			a:    "",
+			b:    "x\ny",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "removed",
+			a:    "x",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1,1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "insert-in-middle",
+			a:    "a\nb\nc",
+			b:    "a\nb\nnew\nc",
+			want: "--- a\n+++ b\n@@ -1,3 +1,4 @@\n a\n b\n+new\n c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwanted\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	a := api.NodeInfoV1{
+		Commands: []api.CmdOut{
+			{Name: "uname", Output: "Linux 5.4"},
+			{Name: "same", Output: "unchanged"},
+			{Name: "lshw", Output: `{"id": "host", "children": [{"id": "cpu", "size": 1}]}`},
+			{Name: "gone", Output: "bye"},
+		},
+	}
+	b := api.NodeInfoV1{
+		Commands: []api.CmdOut{
+			{Name: "uname", Output: "Linux 5.10"},
+			{Name: "same", Output: "unchanged"},
+			{Name: "lshw", Output: `{"id": "host", "children": [{"id": "cpu", "size": 2, "vendor": "x"}]}`},
+			{Name: "new", Output: "hi"},
+		},
+	}
+	want := []Change{
+		{Name: "uname", Status: Changed, Unified: "--- a/uname\n+++ b/uname\n@@ -1,1 +1,1 @@\n-Linux 5.4\n+Linux 5.10\n"},
+		{Name: "lshw", Status: Changed, Fields: []FieldChange{
+			{Path: "children[0].size", Old: 1.0, New: 2.0},
+			{Path: "children[0].vendor", New: "x"},
+		}},
+		{Name: "new", Status: Added, Unified: "--- a/new\n+++ b/new\n@@ -0,0 +1,1 @@\n+hi\n"},
+		{Name: "gone", Status: Removed, Unified: "--- a/gone\n+++ b/gone\n@@ -1,1 +0,0 @@\n-bye\n"},
+	}
+	got := Documents(a, b)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Documents() =\n%#v\nwanted\n%#v", got, want)
+	}
+	if got := Documents(a, a); len(got) != 0 {
+		t.Errorf("Documents(a, a) = %#v, wanted nothing", got)
+	}
+}
+
+func TestDocumentsDuplicateNames(t *testing.T) {
+	a := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "cat", Output: "1"}, {Name: "cat", Output: "2"}}}
+	b := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "cat", Output: "1"}, {Name: "cat", Output: "3"}}}
+	got := Documents(a, b)
+	if len(got) != 1 || got[0].Name != "cat#2" {
+		t.Errorf("Documents() = %#v, wanted one change to cat#2", got)
+	}
+}
+
+func TestDocumentsItems(t *testing.T) {
+	a := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "ethtool", Item: "eth0", Output: "1"}, {Name: "ethtool", Item: "eth1", Output: "2"}}}
+	b := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "ethtool", Item: "eth1", Output: "2"}}}
+	got := Documents(a, b)
+	if len(got) != 1 || got[0].Name != "ethtool[eth0]" || got[0].Status != Removed {
+		t.Errorf("Documents() = %#v, wanted ethtool[eth0] to be removed", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	changes := []Change{
+		{Name: "uname", Status: Changed, Unified: "--- a/uname\n+++ b/uname\n@@ -1,1 +1,1 @@\n-old\n+new\n"},
+		{Name: "lshw", Status: Changed, Fields: []FieldChange{
+			{Path: "added", New: "x"},
+			{Path: "changed", Old: 1.0, New: 2.0},
+			{Path: "removed", Old: true},
+		}},
+	}
+	var text bytes.Buffer
+	rtx.Must(WriteText(&text, changes), "failed to write text")
+	want := "=== uname (changed)\n--- a/uname\n+++ b/uname\n@@ -1,1 +1,1 @@\n-old\n+new\n" +
+		"=== lshw (changed)\n+ added: x\n~ changed: 1 -> 2\n- removed: true\n"
+	if text.String() != want {
+		t.Errorf("WriteText() =\n%s\nwanted\n%s", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	rtx.Must(WriteJSON(&out, changes), "failed to write JSON")
+	var got []Change
+	rtx.Must(json.Unmarshal(out.Bytes(), &got), "failed to parse JSON")
+	if !reflect.DeepEqual(got, changes) {
+		t.Errorf("WriteJSON() round trip = %#v, wanted %#v", got, changes)
+	}
+
+	out.Reset()
+	rtx.Must(WriteJSON(&out, nil), "failed to write empty JSON")
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("WriteJSON(nil) = %q, wanted []", out.String())
+	}
+}
+
+func TestDocumentsSections(t *testing.T) {
+	a := api.NodeInfoV1{Sysctl: []api.Sysctl{{Key: "net.core.rmem_max", Value: "212992"}}}
+	b := api.NodeInfoV1{Sysctl: []api.Sysctl{{Key: "net.core.rmem_max", Value: "4194304"}}}
+	want := []Change{
+		{Name: "sysctl", Status: Changed, Fields: []FieldChange{
+			{Path: "[0].Value", Old: "212992", New: "4194304"},
+		}},
+	}
+	if got := Documents(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Documents() = %#v, wanted %#v", got, want)
+	}
+	got := Documents(api.NodeInfoV1{}, b)
+	if len(got) != 1 || got[0].Status != Added || len(got[0].Fields) != 2 {
+		t.Errorf("Documents() = %#v, wanted an added sysctl section", got)
+	}
+	got = Documents(a, api.NodeInfoV1{})
+	if len(got) != 1 || got[0].Status != Removed {
+		t.Errorf("Documents() = %#v, wanted a removed sysctl section", got)
+	}
+	if Hashes(a)["sysctl"] == Hashes(b)["sysctl"] {
+		t.Error("Hashes() should differ between different sections")
+	}
+}
+
+// lcsLength is the textbook quadratic longest common subsequence, which
+// edits must agree with.
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func TestEditsShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		var gotA, gotB []string
+		changed := 0
+		for _, o := range edits(a, b) {
+			if o.kind != '+' {
+				gotA = append(gotA, o.line)
+			}
+			if o.kind != '-' {
+				gotB = append(gotB, o.line)
+			}
+			if o.kind != ' ' {
+				changed++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits(%q, %q) turns %q into %q", a, b, gotA, gotB)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changed != want {
+			t.Fatalf("edits(%q, %q) changed %d lines, wanted %d", a, b, changed, want)
+		}
+	}
+}
+
+func TestUnifiedLarge(t *testing.T) {
+	// Large outputs with few changes still get a precise diff.
+	a := make([]string, 200000)
+	for i := range a {
+		a[i] = fmt.Sprint(i)
+	}
+	b := append([]string{}, a...)
+	b[1000], b[150000] = "changed", "also changed"
+	got := Unified("a", "b", strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if strings.Count(got, "\n-") != 2 || strings.Count(got, "\n+") != 3 {
+		t.Errorf("Unified() =\n%s\nwanted two changed lines", got)
+	}
+}
@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+// maxDiffBytes bounds the size of the diff in a change record. Longer diffs are
+// cut at the last line that fits, followed by a note of how much was cut.
+const maxDiffBytes = 64 * 1024
+
+// Tracker remembers the document from the previous run, so that it can report
+// which outputs changed. The first run after a Tracker is created only
+// establishes a baseline and reports no changes.
+type Tracker struct {
+	previous     *api.NodeInfoV1
+	previousTime time.Time
+}
+
+// NewTracker creates a Tracker with no baseline.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Seed makes a document saved at the passed-in time the baseline, such as the
+// last one saved before a restart, so that the next run reports changes
+// against it.
+func (t *Tracker) Seed(nodeinfo api.NodeInfoV1, saved time.Time) {
+	t.previous, t.previousTime = &nodeinfo, saved
+}
+
+// Observe records the document gathered at the passed-in time, and returns a
+// change record for every gatherer whose output differs from the previous
+// observation.
+func (t *Tracker) Observe(nodeinfo api.NodeInfoV1, now time.Time) []api.ChangeV1 {
+	previous, previousTime := t.previous, t.previousTime
+	t.previous, t.previousTime = &nodeinfo, now
+	if previous == nil {
+		return nil
+	}
+
+	before, after := Hashes(*previous), Hashes(nodeinfo)
+	var changes []api.ChangeV1
+	for _, c := range Documents(*previous, nodeinfo) {
+		change := api.ChangeV1{
+			Name:         c.Name,
+			PreviousHash: before[c.Name],
+			NewHash:      after[c.Name],
+			Diff:         truncate(c.Compact(), maxDiffBytes),
+			Time:         now,
+		}
+		if c.Status != Added {
+			change.PreviousTime = previousTime
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// truncate returns the text cut to at most max bytes at a line boundary,
+// including a note of how many bytes were cut.
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	const note = "... %d more bytes\n"
+	cut := max - len(fmt.Sprintf(note, len(text)))
+	if cut < 0 {
+		cut = 0
+	}
+	cut = strings.LastIndexByte(text[:cut], '\n') + 1
+	return text[:cut] + fmt.Sprintf(note, len(text)-cut)
+}
@@ -0,0 +1,80 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-lab/nodeinfo/api"
+)
+
+func TestTracker(t *testing.T) {
+	const (
+		hashA = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+		hashB = "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"
+	)
+	t0 := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	t2 := t1.Add(time.Hour)
+
+	tr := NewTracker()
+	first := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "a"}, {Name: "gone", Output: "a"}}}
+	if got := tr.Observe(first, t0); got != nil {
+		t.Errorf("Observe() on the first run = %#v, wanted nil", got)
+	}
+
+	second := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "b"}, {Name: "new", Output: "a"}}}
+	want := []api.ChangeV1{
+		{Name: "uname", PreviousHash: hashA, NewHash: hashB, Diff: "--- a/uname\n+++ b/uname\n@@ -1,1 +1,1 @@\n-a\n+b\n", PreviousTime: t0, Time: t1},
+		{Name: "new", NewHash: hashA, Diff: "--- a/new\n+++ b/new\n@@ -0,0 +1,1 @@\n+a\n", Time: t1},
+		{Name: "gone", PreviousHash: hashA, Diff: "--- a/gone\n+++ b/gone\n@@ -1,1 +0,0 @@\n-a\n", PreviousTime: t0, Time: t1},
+	}
+	if got := tr.Observe(second, t1); !reflect.DeepEqual(got, want) {
+		t.Errorf("Observe() =\n%#v\nwanted\n%#v", got, want)
+	}
+
+	if got := tr.Observe(second, t2); len(got) != 0 {
+		t.Errorf("Observe() with no changes = %#v, wanted nothing", got)
+	}
+}
+
+func TestTrackerSeed(t *testing.T) {
+	t0 := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	tr := NewTracker()
+	tr.Seed(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "a"}}}, t0)
+	got := tr.Observe(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "b"}}}, t1)
+	if len(got) != 1 || got[0].Name != "uname" || got[0].PreviousTime != t0 {
+		t.Errorf("Observe() after Seed() = %#v, wanted a change to uname since %v", got, t0)
+	}
+}
+
+func TestTrackerLargeDiff(t *testing.T) {
+	t0 := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	tr := NewTracker()
+	tr.Seed(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "lshw"}}}, t0)
+	output := strings.Repeat("a long line of lshw output\n", 10000)
+	got := tr.Observe(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "lshw", Output: output}}}, t0.Add(time.Hour))
+	if len(got) != 1 || len(got[0].Diff) > maxDiffBytes || !strings.HasSuffix(got[0].Diff, " more bytes\n") {
+		t.Fatalf("Observe() = %#v, wanted one diff cut to %d bytes", got, maxDiffBytes)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{text: "a\nb\n", max: 4, want: "a\nb\n"},
+		{text: "line one\nline two\nline three\n", max: 28, want: "line one\n... 20 more bytes\n"},
+		{text: "line one\nline two\n", max: 5, want: "... 18 more bytes\n"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.text, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, wanted %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
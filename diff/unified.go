@@ -0,0 +1,199 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around every change.
+const contextLines = 3
+
+// maxWork bounds the number of steps spent searching for a shortest edit
+// script, in lines compared. Inputs that differ more are diffed as a single
+// replaced block.
+const maxWork = 50_000_000
+
+type op struct {
+	kind byte // ' ', '-', or '+'
+	line string
+}
+
+// Unified returns a unified diff between two texts, or the empty string if
+// they are the same.
+func Unified(aName, bName, a, b string) string {
+	ops := edits(lines(a), lines(b))
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the hunk around it.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		begin := first - contextLines
+		if begin < start {
+			begin = start
+		}
+		end := first
+		for i := first; i < len(ops) && i <= end+2*contextLines; i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			}
+		}
+		end += contextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		writeHunk(&sb, ops, begin, end)
+		start = end
+	}
+	return sb.String()
+}
+
+// writeHunk writes the ops in [begin, end) with a hunk header.
+func writeHunk(sb *strings.Builder, ops []op, begin, end int) {
+	aStart, bStart := 1, 1
+	for _, o := range ops[:begin] {
+		if o.kind != '+' {
+			aStart++
+		}
+		if o.kind != '-' {
+			bStart++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, o := range ops[begin:end] {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+	// An empty range is identified by the line before it.
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, o := range ops[begin:end] {
+		sb.WriteByte(o.kind)
+		sb.WriteString(o.line)
+		sb.WriteByte('\n')
+	}
+}
+
+// edits returns the shortest edit script turning a into b.
+func edits(a, b []string) []op {
+	return diffLines(nil, a, b)
+}
+
+// diffLines appends the edits turning a into b to ops. It uses the linear
+// space variant of Myers' algorithm, which splits the inputs at the middle of
+// a shortest edit script and recurses on both halves, so that diffing large
+// outputs in the daemon doesn't need a table of their product.
+func diffLines(ops []op, a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, op{' ', a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y, u, v, ok := middleSnake(a, b)
+	if ok {
+		ops = diffLines(ops, a[:x], b[:y])
+		for _, l := range a[x:u] {
+			ops = append(ops, op{' ', l})
+		}
+		ops = diffLines(ops, a[u:], b[v:])
+	} else {
+		// Either side is empty, or they differ too much to be worth the
+		// search, so a is replaced by b as a whole.
+		for _, l := range a {
+			ops = append(ops, op{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, op{'+', l})
+		}
+	}
+	for _, l := range common {
+		ops = append(ops, op{' ', l})
+	}
+	return ops
+}
+
+// middleSnake returns the diagonal run of equal lines, from a[x], b[y] to
+// a[u], b[v], in the middle of a shortest edit script turning a into b, by
+// searching forward from the start and backward from the end at once. It
+// returns false if either input is empty or the search exceeds maxWork.
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, 0, 0, false
+	}
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+	// forward[k] is how far along a the furthest forward path on diagonal
+	// k = x - y reaches, and backward[c] the same for the paths from the end
+	// of both inputs, with c counted from there.
+	offset := max + 1
+	forward := make([]int32, 2*max+3)
+	backward := make([]int32, 2*max+3)
+	for d := 0; d <= max; d++ {
+		if d*(n+m) > maxWork {
+			return 0, 0, 0, 0, false
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = int(forward[offset+k+1])
+			} else {
+				x = int(forward[offset+k-1]) + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = int32(x)
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+int(backward[offset+c]) >= n {
+				return x0, y0, x, y, true
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || (c != d && backward[offset+c-1] < backward[offset+c+1]) {
+				x = int(backward[offset+c+1])
+			} else {
+				x = int(backward[offset+c-1]) + 1
+			}
+			y := x - c
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+c] = int32(x)
+			if k := delta - c; !odd && k >= -d && k <= d && x+int(forward[offset+k]) >= n {
+				return n - x, m - y, n - x0, m - y0, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
@@ -3,6 +3,7 @@ module github.com/m-lab/nodeinfo
 go 1.20
 
 require (
+	github.com/klauspost/compress v1.16.7
 	github.com/m-lab/go v0.1.45
 	github.com/prometheus/client_golang v1.11.0
 )
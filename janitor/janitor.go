@@ -0,0 +1,117 @@
+// Package janitor enforces local retention limits on the data saved by
+// nodeinfo, so that a node whose uploader is down does not fill its disk.
+package janitor
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// Janitor deletes old files from a directory tree. Files older than MaxAge are
+// always deleted, and then the oldest remaining files are deleted until the
+// tree holds no more than MaxBytes. A zero limit disables that check.
+type Janitor struct {
+	Dir      string
+	MaxAge   time.Duration
+	MaxBytes int64
+
+	// Now returns the current time. It is a field so tests can fake the clock.
+	Now func() time.Time
+}
+
+// New creates a Janitor for the passed-in directory that uses the system clock.
+func New(dir string, maxAge time.Duration, maxBytes int64) *Janitor {
+	return &Janitor{
+		Dir:      dir,
+		MaxAge:   maxAge,
+		MaxBytes: maxBytes,
+		Now:      time.Now,
+	}
+}
+
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Clean enforces the age and size limits on the directory, oldest files
+// first, and then removes any directories that were left empty. Returns the
+// first error encountered, if any.
+func (j *Janitor) Clean() error {
+	if j.MaxAge <= 0 && j.MaxBytes <= 0 {
+		return nil
+	}
+	var files []file
+	var dirs []string
+	var total int64
+	err := filepath.WalkDir(j.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != j.Dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to walk %v (error: %v)\n", j.Dir, err)
+		return err
+	}
+	sort.Slice(files, func(a, b int) bool {
+		if files[a].modTime.Equal(files[b].modTime) {
+			return files[a].path < files[b].path
+		}
+		return files[a].modTime.Before(files[b].modTime)
+	})
+
+	cutoff := j.Now().Add(-j.MaxAge)
+	for _, f := range files {
+		var reason string
+		switch {
+		case j.MaxAge > 0 && f.modTime.Before(cutoff):
+			reason = "age"
+		case j.MaxBytes > 0 && total > j.MaxBytes:
+			reason = "quota"
+		default:
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("failed to remove %v (error: %v)\n", f.path, err)
+			return err
+		}
+		total -= f.size
+		metrics.JanitorDeletedFiles.WithLabelValues(reason).Inc()
+		metrics.JanitorDeletedBytes.WithLabelValues(reason).Add(float64(f.size))
+	}
+
+	// Remove empty directories, deepest first. WalkDir visits parents before
+	// their children, so walking the list backwards visits children first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			log.Printf("failed to remove %v (error: %v)\n", dirs[i], err)
+			return err
+		}
+		metrics.JanitorDeletedDirs.Inc()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package janitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-lab/go/rtx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/m-lab/nodeinfo/metrics"
+)
+
+// writeFile creates a file of the given size under dir with a modification
+// time of the given age relative to now.
+func writeFile(dir, name string, size int, now time.Time, age time.Duration) string {
+	path := filepath.Join(dir, name)
+	rtx.Must(os.MkdirAll(filepath.Dir(path), 0o775), "failed to create dir for %v", path)
+	rtx.Must(ioutil.WriteFile(path, make([]byte, size), 0o666), "failed to write %v", path)
+	mtime := now.Add(-age)
+	rtx.Must(os.Chtimes(path, mtime, mtime), "failed to set time on %v", path)
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestClean")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2023, 6, 10, 12, 0, 0, 0, time.UTC)
+	ancient := writeFile(dir, "2023/06/01/a.json", 10, now, 9*24*time.Hour)
+	old := writeFile(dir, "2023/06/08/b.json", 10, now, 2*24*time.Hour)
+	older := writeFile(dir, "2023/06/08/c.json", 10, now, 2*24*time.Hour+time.Minute)
+	recent := writeFile(dir, "2023/06/10/d.json", 10, now, time.Hour)
+	newest := writeFile(dir, "2023/06/10/e.json", 10, now, time.Minute)
+
+	ageFiles := testutil.ToFloat64(metrics.JanitorDeletedFiles.WithLabelValues("age"))
+	quotaFiles := testutil.ToFloat64(metrics.JanitorDeletedFiles.WithLabelValues("quota"))
+
+	j := New(dir, 7*24*time.Hour, 25)
+	j.Now = func() time.Time { return now }
+	rtx.Must(j.Clean(), "failed to clean")
+
+	for _, path := range []string{ancient, older, old} {
+		if exists(path) {
+			t.Errorf("%v should have been deleted", path)
+		}
+	}
+	for _, path := range []string{recent, newest} {
+		if !exists(path) {
+			t.Errorf("%v should not have been deleted", path)
+		}
+	}
+	for _, path := range []string{"2023/06/01", "2023/06/08"} {
+		if exists(filepath.Join(dir, path)) {
+			t.Errorf("empty directory %v should have been deleted", path)
+		}
+	}
+	if !exists(dir) {
+		t.Error("the top-level directory should never be deleted")
+	}
+	if got := testutil.ToFloat64(metrics.JanitorDeletedFiles.WithLabelValues("age")) - ageFiles; got != 1 {
+		t.Errorf("age deletions = %v, wanted 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.JanitorDeletedFiles.WithLabelValues("quota")) - quotaFiles; got != 2 {
+		t.Errorf("quota deletions = %v, wanted 2", got)
+	}
+}
+
+func TestCleanDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCleanDisabled")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	path := writeFile(dir, "2001/01/01/a.json", 1000, now, 20*365*24*time.Hour)
+	rtx.Must(New(dir, 0, 0).Clean(), "failed to clean")
+	if !exists(path) {
+		t.Errorf("%v should not have been deleted", path)
+	}
+}
+
+func TestCleanMissingDir(t *testing.T) {
+	j := New("/this/dir/does/not/exist", time.Hour, 0)
+	if j.Clean() == nil {
+		t.Error("Clean() = nil, wanted error")
+	}
+}
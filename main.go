@@ -12,8 +12,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -21,6 +23,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/m-lab/go/bytecount"
 	"github.com/m-lab/go/flagx"
 	"github.com/m-lab/go/memoryless"
 	"github.com/m-lab/go/prometheusx"
@@ -29,6 +32,8 @@ import (
 	"github.com/m-lab/nodeinfo/api"
 	"github.com/m-lab/nodeinfo/config"
 	"github.com/m-lab/nodeinfo/data"
+	"github.com/m-lab/nodeinfo/diff"
+	"github.com/m-lab/nodeinfo/janitor"
 	"github.com/m-lab/nodeinfo/metrics"
 )
 
@@ -40,18 +45,47 @@ var (
 	schemaFile = flag.String("schemafile", "/nodeinfo1.json", "The datatype schema file")
 	once       = flag.Bool("once", false, "Only gather data once")
 	smoketest  = flag.Bool("smoketest", false, "Gather every type of data once. Used to test that all configured data types can be gathered.")
+	junitFile  = flag.String("junit", "", "With -smoketest, also write the results as a JUnit XML report to this file")
+	dryRun     = flag.Bool("dry-run", false, "Gather every type of data once and print the result to stdout without saving it or touching the spool and schema directories")
 	waittime   = flag.Duration("wait", 1*time.Hour, "How long (in expectation) to wait between runs")
 	configFile = flag.String("config", "/etc/nodeinfo/config.json", "The name of the config file to load from disk.")
+	maxAge     = flag.Duration("max-age", 0, "Delete saved data older than this from the datatype directory. Zero disables the limit.")
+	rowSchema  = flag.String("rowschemafile", "/nodeinforow1.json", "The datatype schema file used instead of -schemafile with the ndjson layout. It must be named after -datatype, e.g. nodeinforow1.json for -datatype=nodeinforow1.")
+
+	hostRoot    = flag.String("hostroot", "", "Where the host's root filesystem is mounted. Gatherers with UseHostRoot read absolute paths under it.")
+	replayDir   = flag.String("replay", "", "Read the output of every gatherer from <name>.txt in this fixtures directory instead of running commands. Built-in collectors are refused unless they read a host tree given with -hostroot.")
+	recordDir   = flag.String("record", "", "Record the output of every gatherer into <name>.txt in this fixtures directory, for later use with -replay. WARNING: recordings are NOT redacted and may contain secrets; they are written readable only by their owner.")
+	sinkTimeout = flag.Duration("sink-timeout", data.HTTPTimeout, "How long to wait for an http(s) sink to accept a document before giving up")
+	policy      = flag.String("policy", "", "A JSON file allowlisting the executables and arguments gatherers may run. Empty allows every command.")
+
+	changeDatatype   = flag.String("changedatatype", "", "Datatype of the change records saved whenever a gatherer's output changes, e.g. nodeinfochange1. Empty disables change records.")
+	changeSchemaFile = flag.String("changeschemafile", "/nodeinfochange1.json", "The datatype schema file of the change records")
+
+	maxBytes    bytecount.ByteCount
+	salt        flagx.FileBytes
+	compression = flagx.Enum{Options: data.Compressions, Value: data.CompressionNone}
+	layout      = flagx.Enum{Options: data.Layouts, Value: data.LayoutDocument}
+	sinkSpecs   flagx.StringArray
 
 	// A context and associate cancellation function which, when called, should cause main to exit.
 	mainCtx, mainCancel = context.WithCancel(context.Background())
 
 	// Contents of this should be filled in as part of parsing commandline flags.
 	gatherers config.Config
+	sinks     []data.Sink
+	tracker   = diff.NewTracker()
+
+	// Set by a smoketest run to report its failures once main is done.
+	smoketestErr error
 )
 
 func init() {
 	log.SetFlags(log.Lshortfile | log.LUTC | log.LstdFlags)
+	flag.Var(&maxBytes, "max-bytes", "Delete the oldest saved data once the datatype directory holds more than this many bytes. Zero disables the limit.")
+	flag.Var(&compression, "compression", fmt.Sprintf("How to compress saved data, one of %v", data.Compressions))
+	flag.Var(&layout, "layout", "How to lay out saved data: document saves one NodeInfo document per run, ndjson saves one row per command")
+	flag.Var(&salt, "redaction-salt-file", "A file containing the per-deployment secret used to hash redacted output. Hash redactions are refused without it.")
+	flag.Var(&sinkSpecs, "sink", "Where to write gathered data: spool, stdout, jsonl:<filename>, or an http(s) URL. May be repeated. Defaults to spool.")
 }
 
 // Runs every data gatherer.
@@ -61,51 +95,284 @@ func gather() {
 		log.Printf("failed to reload the config (error: %v). Using old config.\n", err)
 	}
 	var nodeinfo api.NodeInfoV1
+	var results []data.Result
 	for _, g := range gatherers.Gatherers() {
-		g.Gather(*smoketest, &nodeinfo)
+		results = append(results, g.Gather(false, &nodeinfo))
+	}
+	if *smoketest {
+		smoketestErr = reportSmoketest(os.Stdout, results)
 	}
-	if _, err := data.Save(*datadir, *datatype, nodeinfo); err != nil {
+	if err := data.WriteAll(sinks, nodeinfo); err != nil {
 		log.Printf("failed to save data (error: %v)\n", err)
 	}
+	datatypes := []string{*datatype}
+	if *changeDatatype != "" {
+		saveChanges(nodeinfo)
+		datatypes = append(datatypes, *changeDatatype)
+	}
+	for _, dt := range datatypes {
+		j := janitor.New(filepath.Join(*datadir, dt), *maxAge, int64(maxBytes))
+		if err := j.Clean(); err != nil {
+			log.Printf("failed to enforce retention limits (error: %v)\n", err)
+		}
+	}
+}
+
+// reportSmoketest prints the result of every gatherer, optionally writes them
+// to a JUnit XML report, and returns an error if any of them failed.
+func reportSmoketest(w io.Writer, results []data.Result) error {
+	if err := data.WriteReport(w, results); err != nil {
+		return err
+	}
+	if *junitFile != "" {
+		f, err := os.Create(*junitFile)
+		if err != nil {
+			return err
+		}
+		if err := data.WriteJUnit(f, "nodeinfo-smoketest", results); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if failed := data.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d gatherers failed", failed, len(results))
+	}
+	return nil
+}
+
+// saveChanges saves a change record for every gatherer whose output differs
+// from the previous run, if there are any.
+func saveChanges(nodeinfo api.NodeInfoV1) {
+	changes := tracker.Observe(nodeinfo, time.Now().UTC())
+	if len(changes) == 0 {
+		return
+	}
+	doc := api.NodeInfoChangeV1{Changes: changes}
+	if _, err := data.SaveChanges(*datadir, *changeDatatype, compression.Value, doc); err != nil {
+		log.Printf("failed to save changes (error: %v)\n", err)
+	}
 }
 
-// setupFS copies the datatype schema file (default /nodeinfo1)
-// to the datatypes directory (default /var/spool/datatypes) and
-// also creates the directory where data will be written to (default
-// /var/spool/host/nodeinfo1).
+// seedTracker makes the newest document saved today or yesterday the baseline
+// for change records, so that changes made across a restart are recorded
+// instead of silently becoming the new baseline.
+func seedTracker(now time.Time) {
+	for _, date := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		file, err := data.Latest(*datadir, *datatype, date)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Printf("failed to stat %v (error: %v)\n", file, err)
+			return
+		}
+		nodeinfo, err := data.Load(file)
+		if err != nil {
+			log.Printf("failed to load %v as the change baseline (error: %v)\n", file, err)
+			return
+		}
+		tracker.Seed(nodeinfo, info.ModTime().UTC())
+		return
+	}
+}
+
+// setupFS copies the datatype schema file for the chosen layout (default
+// /nodeinfo1.json) to the datatypes directory (default /var/spool/datatypes)
+// and also creates the directory where data will be written to (default
+// /var/spool/host/nodeinfo1). If change records are enabled, it does the same
+// for their schema and directory.
 func setupFS() error {
-	contents, err := os.ReadFile(*schemaFile)
+	schema := *schemaFile
+	if layout.Value == data.LayoutNDJSON {
+		schema = *rowSchema
+		// The uploader loads every datatype directory with the schema named
+		// after it, so rows must not be saved under the document datatype.
+		if filepath.Base(schema) != *datatype+".json" {
+			return fmt.Errorf("the %v layout saves rows under -datatype %v, which needs a -rowschemafile named %v.json, not %v",
+				data.LayoutNDJSON, *datatype, *datatype, filepath.Base(schema))
+		}
+	}
+	if err := copySchema(schema); err != nil {
+		return err
+	}
+	datatypes := []string{*datatype}
+	if *changeDatatype != "" {
+		if err := copySchema(*changeSchemaFile); err != nil {
+			return err
+		}
+		datatypes = append(datatypes, *changeDatatype)
+	}
+	for _, dt := range datatypes {
+		directory := filepath.Join(*datadir, dt)
+		if err := os.MkdirAll(directory, 0o775); err != nil {
+			log.Printf("failed to create %v: %v\n", directory, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// copySchema copies a schema file into the datatypes directory.
+func copySchema(schema string) error {
+	contents, err := os.ReadFile(schema)
 	if err != nil {
-		log.Printf("failed to read %v: %v\n", *schemaFile, err)
+		log.Printf("failed to read %v: %v\n", schema, err)
 		return err
 	}
 	if err := os.MkdirAll(*schemaDir, 0o775); err != nil {
-		log.Printf("failed to create %v: %v\n", schemaDir, err)
+		log.Printf("failed to create %v: %v\n", *schemaDir, err)
 		return err
 	}
-	file := filepath.Join(*schemaDir, filepath.Base(*schemaFile))
+	file := filepath.Join(*schemaDir, filepath.Base(schema))
 	if err := os.WriteFile(file, contents, 0o644); err != nil {
 		log.Printf("failed to write %v: %v\n", file, err)
 		return err
 	}
-	directory := filepath.Join(*datadir, *datatype)
-	if err := os.MkdirAll(directory, 0o775); err != nil {
-		log.Printf("failed to create %v: %v\n", directory, err)
+	return nil
+}
+
+// setupPolicy loads the command policy, if there is one.
+func setupPolicy() error {
+	data.ActivePolicy = nil
+	if *policy == "" {
+		return nil
+	}
+	p, err := data.LoadPolicy(*policy)
+	if err != nil {
 		return err
 	}
+	data.ActivePolicy = p
 	return nil
 }
 
+// setupRunner chooses how gatherers get their output: by running commands, by
+// replaying recorded outputs, or by running commands and recording outputs.
+func setupRunner() error {
+	switch {
+	case *replayDir != "" && *recordDir != "":
+		return fmt.Errorf("-replay and -record can not be used together")
+	case *replayDir != "":
+		data.CommandRunner = data.ReplayRunner{Dir: *replayDir}
+	case *recordDir != "":
+		data.CommandRunner = data.RecordingRunner{Runner: data.ExecRunner{}, Dir: *recordDir}
+	default:
+		data.CommandRunner = data.ExecRunner{}
+	}
+	return nil
+}
+
+// setupSinks creates every sink named with -sink, defaulting to the spool
+// directory when none are named.
+func setupSinks() error {
+	spool := &data.SpoolSink{Datadir: *datadir, Datatype: *datatype, Layout: layout.Value, Compression: compression.Value}
+	specs := sinkSpecs
+	if len(specs) == 0 {
+		specs = flagx.StringArray{"spool"}
+	}
+	sinks = nil
+	for _, spec := range specs {
+		s, err := data.NewSink(spec, spool)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, s)
+	}
+	return nil
+}
+
+// runDiff implements "nodeinfo diff [-json] OLD NEW", which prints how the
+// gathered data changed between two saved documents. OLD and NEW are either
+// filenames or dates formatted as YYYY-MM-DD, which select the last document
+// saved that day under -datadir.
+func runDiff(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the differences as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff needs exactly two documents or dates, got %q", fs.Args())
+	}
+	var docs [2]api.NodeInfoV1
+	for i, arg := range fs.Args() {
+		file := arg
+		if date, err := time.Parse("2006-01-02", arg); err == nil {
+			if file, err = data.Latest(*datadir, *datatype, date); err != nil {
+				return err
+			}
+		}
+		var err error
+		if docs[i], err = data.Load(file); err != nil {
+			return fmt.Errorf("failed to load %v (error: %v)", file, err)
+		}
+	}
+	changes := diff.Documents(docs[0], docs[1])
+	if *asJSON {
+		return diff.WriteJSON(w, changes)
+	}
+	return diff.WriteText(w, changes)
+}
+
+// runDryRun runs every configured gatherer once and prints the resulting
+// document, followed by how long each gatherer took. Nothing is saved.
+func runDryRun(w io.Writer) error {
+	c, err := config.Create(*configFile)
+	if err != nil {
+		return err
+	}
+	var nodeinfo api.NodeInfoV1
+	var results []data.Result
+	for _, g := range c.Gatherers() {
+		results = append(results, g.Gather(false, &nodeinfo))
+	}
+	b, err := json.MarshalIndent(nodeinfo, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s\n\n", b); err != nil {
+		return err
+	}
+	return data.WriteReport(w, results)
+}
+
 func main() {
+	// The flags are logged rather than printed, since the diff and dry-run
+	// modes print their results to stdout.
 	flag.VisitAll(func(f *flag.Flag) {
-		fmt.Printf("%s: %s\n", f.Name, f.Value)
+		log.Printf("%s: %s\n", f.Name, f.Value)
 	})
 	flag.Parse()
 	rtx.Must(flagx.ArgsFromEnv(flag.CommandLine), "failed to parse args from environment")
+	data.RedactionSalt = salt
+	data.HostRoot = *hostRoot
+	data.SpoolLayout = layout.Value
+	data.HTTPTimeout = *sinkTimeout
+	rtx.Must(setupRunner(), "failed to set up the command runner")
+	rtx.Must(setupPolicy(), "failed to load the command policy")
+
+	if flag.Arg(0) == "diff" {
+		rtx.Must(runDiff(os.Stdout, flag.Args()[1:]), "failed to diff")
+		return
+	}
+	if *dryRun {
+		rtx.Must(runDryRun(os.Stdout), "failed to do a dry run")
+		return
+	}
 
 	rtx.Must(uniformnames.Check(path.Base(*datadir)), "The destination directory does not conform to the M-Lab uniform naming conventions")
 	rtx.Must(uniformnames.Check(*datatype), "Datatype does not conform to the M-Lab uniform naming conventions")
+	if *changeDatatype != "" {
+		rtx.Must(uniformnames.Check(*changeDatatype), "Change datatype does not conform to the M-Lab uniform naming conventions")
+	}
 	rtx.Must(setupFS(), "failed to set up filesystem")
+	rtx.Must(setupSinks(), "failed to set up sinks")
+	if *changeDatatype != "" {
+		seedTracker(time.Now().UTC())
+	}
 
 	metricSrv := prometheusx.MustServeMetrics()
 	defer metricSrv.Shutdown(mainCtx)
@@ -119,7 +386,9 @@ func main() {
 	// nodeinfo container is restarted:
 	// https://github.com/m-lab/dev-tracker/issues/689
 	rand.Seed(time.Now().UnixNano())
+	smoketestErr = nil
 	rtx.Must(
 		memoryless.Run(mainCtx, gather, memoryless.Config{Expected: *waittime, Max: 4 * (*waittime), Once: *once || *smoketest}),
 		"Bad time arguments.")
+	rtx.Must(smoketestErr, "smoketest failed")
 }
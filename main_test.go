@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -12,32 +16,18 @@ import (
 	"github.com/m-lab/go/prometheusx"
 
 	"github.com/m-lab/go/rtx"
+	"github.com/m-lab/nodeinfo/api"
+	"github.com/m-lab/nodeinfo/data"
+	"github.com/m-lab/nodeinfo/diff"
 )
 
-var dtSchema = `[
-  {
-    "fields": [
-      {
-        "mode": "NULLABLE",
-        "name": "Output",
-        "type": "STRING"
-      },
-      {
-        "mode": "NULLABLE",
-        "name": "CommandLine",
-        "type": "STRING"
-      },
-      {
-        "mode": "NULLABLE",
-        "name": "Name",
-        "type": "STRING"
-      }
-    ],
-    "mode": "REPEATED",
-    "name": "commands",
-    "type": "RECORD"
-  }
-]`
+// dtSchema is the checked-in datatype schema, which is generated from the api
+// types.
+var dtSchema = func() []byte {
+	b, err := os.ReadFile("api/nodeinfo1.json")
+	rtx.Must(err, "failed to read the checked-in schema")
+	return b
+}()
 
 func countFiles(dir string) int {
 	filecount := 0
@@ -65,7 +55,7 @@ func TestMainOnce(t *testing.T) {
 
 	config := `[{"Name": "uname", "Cmd": ["uname", "-a"]}]`
 	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(config), 0o666), "failed to write config")
-	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", []byte(dtSchema), 0o666), "failed to write schema")
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", dtSchema, 0o666), "failed to write schema")
 
 	*datadir = dir + "/data"
 	*schemaDir = dir + "/datatypes"
@@ -95,7 +85,7 @@ func TestMainMultipleAndReload(t *testing.T) {
 	rtx.Must(err, "failed to create tempdir")
 	defer os.RemoveAll(dir)
 	rtx.Must(os.MkdirAll(dir+"/data", 0o777), "failed to create data subdir")
-	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", []byte(dtSchema), 0o666), "failed to write schema")
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", dtSchema, 0o666), "failed to write schema")
 
 	*datadir = dir + "/data"
 	*schemaDir = dir + "/datatypes"
@@ -164,3 +154,342 @@ func TestMainMultipleAndReload(t *testing.T) {
 	mainCancel()
 	wg.Wait()
 }
+
+func TestSetupFSLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSetupFSLayout")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", dtSchema, 0o666), "failed to write schema")
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinforow1.json", []byte("[]"), 0o666), "failed to write row schema")
+
+	*datadir = dir + "/data"
+	*datatype = "nodeinforow1"
+	*schemaDir = dir + "/datatypes"
+	*schemaFile = dir + "/nodeinfo1.json"
+	*rowSchema = dir + "/nodeinforow1.json"
+	rtx.Must(layout.Set(data.LayoutNDJSON), "failed to set layout")
+	defer func() {
+		*datatype = "nodeinfo1"
+		layout.Set(data.LayoutDocument)
+	}()
+
+	rtx.Must(setupFS(), "failed to set up filesystem")
+	if _, err := os.Stat(dir + "/datatypes/nodeinforow1.json"); err != nil {
+		t.Errorf("the row schema was not copied (error: %v)", err)
+	}
+	if _, err := os.Stat(dir + "/datatypes/nodeinfo1.json"); err == nil {
+		t.Error("the document schema should not have been copied")
+	}
+	if _, err := os.Stat(dir + "/data/nodeinforow1"); err != nil {
+		t.Errorf("the data directory was not created (error: %v)", err)
+	}
+
+	*datatype = "nodeinfo1"
+	if setupFS() == nil {
+		t.Error("setupFS() = nil, wanted an error for rows saved under the document datatype")
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRunDiff")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	*datadir = dir
+	*datatype = "nodeinfo1"
+
+	day := dir + "/nodeinfo1/2023/06/01"
+	rtx.Must(os.MkdirAll(day, 0o775), "failed to create day dir")
+	before := `{"commands":[{"Name":"uname","CommandLine":"uname -a","Output":"Linux 5.4"}]}`
+	rtx.Must(ioutil.WriteFile(day+"/20230601T000000.000000Z.json", []byte(before), 0o666), "failed to write old document")
+	after := `{"commands":[{"Name":"uname","CommandLine":"uname -a","Output":"Linux 5.10"}]}`
+	rtx.Must(ioutil.WriteFile(dir+"/new.json", []byte(after), 0o666), "failed to write new document")
+
+	var out bytes.Buffer
+	rtx.Must(runDiff(&out, []string{"2023-06-01", dir + "/new.json"}), "failed to diff")
+	want := "=== uname (changed)\n--- a/uname\n+++ b/uname\n@@ -1,1 +1,1 @@\n-Linux 5.4\n+Linux 5.10\n"
+	if out.String() != want {
+		t.Errorf("runDiff() printed\n%s\nwanted\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	rtx.Must(runDiff(&out, []string{"-json", "2023-06-01", "2023-06-01"}), "failed to diff as JSON")
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("runDiff() printed %q, wanted []", out.String())
+	}
+
+	for _, args := range [][]string{
+		{"2023-06-01"},
+		{"2023-06-01", "2023-06-02"},
+		{"2023-06-01", dir + "/missing.json"},
+		{"-bad-flag", "a", "b"},
+	} {
+		if runDiff(&out, args) == nil {
+			t.Errorf("runDiff(%q) = nil, wanted error", args)
+		}
+	}
+}
+
+// mainStdout runs main with the command-line arguments and returns what it
+// printed to stdout.
+func mainStdout(t *testing.T, args ...string) []byte {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	rtx.Must(err, "failed to create stdout file")
+	defer f.Close()
+	savedArgs, savedStdout := os.Args, os.Stdout
+	defer func() { os.Args, os.Stdout = savedArgs, savedStdout }()
+	os.Args = append([]string{"nodeinfo"}, args...)
+	os.Stdout = f
+
+	main()
+	out, err := os.ReadFile(f.Name())
+	rtx.Must(err, "failed to read stdout")
+	return out
+}
+
+func TestMainDiffJSON(t *testing.T) {
+	dir := t.TempDir()
+	before := `{"commands":[{"Name":"uname","CommandLine":"uname -a","Output":"Linux 5.4"}]}`
+	rtx.Must(ioutil.WriteFile(dir+"/old.json", []byte(before), 0o666), "failed to write old document")
+	after := `{"commands":[{"Name":"uname","CommandLine":"uname -a","Output":"Linux 5.10"}]}`
+	rtx.Must(ioutil.WriteFile(dir+"/new.json", []byte(after), 0o666), "failed to write new document")
+
+	// Automation reads the changes from stdout, so nothing else may be there.
+	out := mainStdout(t, "diff", "-json", dir+"/old.json", dir+"/new.json")
+	var changes []diff.Change
+	if err := json.Unmarshal(out, &changes); err != nil || len(changes) != 1 {
+		t.Errorf("diff -json printed %q (error: %v), wanted one change as JSON", out, err)
+	}
+}
+
+func TestChangeRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestChangeRecords")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	changeSchema, err := os.ReadFile("api/nodeinfochange1.json")
+	rtx.Must(err, "failed to read the change schema")
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", dtSchema, 0o666), "failed to write schema")
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfochange1.json", changeSchema, 0o666), "failed to write change schema")
+
+	*datadir = dir + "/data"
+	*datatype = "nodeinfo1"
+	*schemaDir = dir + "/datatypes"
+	*schemaFile = dir + "/nodeinfo1.json"
+	*changeSchemaFile = dir + "/nodeinfochange1.json"
+	*changeDatatype = "nodeinfochange1"
+	tracker = diff.NewTracker()
+	defer func() { *changeDatatype = "" }()
+
+	rtx.Must(setupFS(), "failed to set up filesystem")
+	if _, err := os.Stat(dir + "/datatypes/nodeinfochange1.json"); err != nil {
+		t.Errorf("the change schema was not copied (error: %v)", err)
+	}
+
+	// The first run is the baseline, and the third run has no changes.
+	saveChanges(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "Linux 5.4"}}})
+	saveChanges(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "Linux 5.10"}}})
+	saveChanges(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "Linux 5.10"}}})
+	files, err := filepath.Glob(dir + "/data/nodeinfochange1/*/*/*/*.json")
+	rtx.Must(err, "failed to glob")
+	if len(files) != 1 {
+		t.Fatalf("change files = %v, wanted 1", files)
+	}
+	contents, err := os.ReadFile(files[0])
+	rtx.Must(err, "failed to read change file")
+	var changes api.NodeInfoChangeV1
+	rtx.Must(json.Unmarshal(contents, &changes), "failed to parse change file")
+	if len(changes.Changes) != 1 || changes.Changes[0].Name != "uname" || changes.Changes[0].Diff == "" {
+		t.Errorf("changes = %#v, wanted one change to uname", changes)
+	}
+}
+
+func TestSeedTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSeedTracker")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+
+	*datadir = dir + "/data"
+	*datatype = "nodeinfo1"
+	*changeDatatype = "nodeinfochange1"
+	tracker = diff.NewTracker()
+	defer func() { *changeDatatype = "" }()
+
+	// The document saved before a restart is the baseline, so the first run
+	// after it already records the change.
+	before := api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "Linux 5.4"}}}
+	_, err = data.Save(*datadir, *datatype, data.LayoutDocument, data.CompressionGzip, before)
+	rtx.Must(err, "failed to save the previous document")
+	seedTracker(time.Now().UTC())
+	saveChanges(api.NodeInfoV1{Commands: []api.CmdOut{{Name: "uname", Output: "Linux 5.10"}}})
+	files, err := filepath.Glob(dir + "/data/nodeinfochange1/*/*/*/*.json")
+	rtx.Must(err, "failed to glob")
+	if len(files) != 1 {
+		t.Errorf("change files = %v, wanted 1", files)
+	}
+}
+
+func TestMainReplay(t *testing.T) {
+	// Reset global variables into a known-good start state.
+	mainCtx, mainCancel = context.WithCancel(context.Background())
+	defer mainCancel()
+
+	dir, err := ioutil.TempDir("", "TestMainReplay")
+	rtx.Must(err, "failed to create temp data dir")
+	defer os.RemoveAll(dir)
+	rtx.Must(ioutil.WriteFile(dir+"/nodeinfo1.json", dtSchema, 0o666), "failed to write schema")
+
+	fixtures := "testdata/fixtures/mlab1-lga0t"
+	*datadir = dir + "/data"
+	*datatype = "nodeinfo1"
+	*schemaDir = dir + "/datatypes"
+	*schemaFile = dir + "/nodeinfo1.json"
+	*configFile = "testdata/config.json"
+	*replayDir = fixtures
+	*once = true
+	*smoketest = true
+	*waittime = time.Millisecond
+	*prometheusx.ListenAddress = ":0"
+	defer func() {
+		*replayDir = ""
+		data.CommandRunner = data.ExecRunner{}
+	}()
+
+	// Run main. None of the configured commands are run, so this works even
+	// on machines without lshw, lspci, or lsusb.
+	main()
+
+	files, err := filepath.Glob(dir + "/data/nodeinfo1/*/*/*/*.json")
+	rtx.Must(err, "failed to glob")
+	if len(files) != 1 {
+		t.Fatalf("files = %v, wanted 1", files)
+	}
+	nodeinfo, err := data.Load(files[0])
+	rtx.Must(err, "failed to load saved data")
+	if len(nodeinfo.Commands) != 8 {
+		t.Errorf("len(nodeinfo.Commands) = %d, wanted 8", len(nodeinfo.Commands))
+	}
+	for _, cmd := range nodeinfo.Commands {
+		want, err := os.ReadFile(fixtures + "/" + cmd.Name + ".txt")
+		rtx.Must(err, "failed to read fixture for %v", cmd.Name)
+		if cmd.Output != strings.TrimSuffix(string(want), "\n") {
+			t.Errorf("%v output = %q, wanted %q", cmd.Name, cmd.Output, want)
+		}
+	}
+}
+
+func TestSetupRunner(t *testing.T) {
+	defer func() {
+		*replayDir = ""
+		*recordDir = ""
+		data.CommandRunner = data.ExecRunner{}
+	}()
+	*recordDir = "/tmp/fixtures"
+	rtx.Must(setupRunner(), "failed to set up recording")
+	if _, ok := data.CommandRunner.(data.RecordingRunner); !ok {
+		t.Errorf("CommandRunner = %#v, wanted a RecordingRunner", data.CommandRunner)
+	}
+	*replayDir = "/tmp/fixtures"
+	if setupRunner() == nil {
+		t.Error("setupRunner() = nil, wanted error when both -replay and -record are set")
+	}
+}
+
+func TestSetupPolicy(t *testing.T) {
+	defer func() {
+		*policy = ""
+		data.ActivePolicy = nil
+	}()
+	dir := t.TempDir()
+	rtx.Must(ioutil.WriteFile(dir+"/policy.json", []byte(`{"Rules": [{"Path": "/usr/bin/uname"}]}`), 0o666), "failed to write policy")
+	*policy = dir + "/policy.json"
+	rtx.Must(setupPolicy(), "failed to load policy")
+	if data.ActivePolicy == nil || len(data.ActivePolicy.Rules) != 1 {
+		t.Errorf("ActivePolicy = %#v, wanted one rule", data.ActivePolicy)
+	}
+	*policy = dir + "/missing.json"
+	if setupPolicy() == nil {
+		t.Error("setupPolicy() = nil, wanted an error for a missing file")
+	}
+	*policy = ""
+	rtx.Must(setupPolicy(), "failed to clear policy")
+	if data.ActivePolicy != nil {
+		t.Errorf("ActivePolicy = %#v, wanted nil without -policy", data.ActivePolicy)
+	}
+}
+
+func TestMainDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMainDryRun")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+
+	config := `[
+		{"Name": "uname", "Cmd": ["uname", "-a"]},
+		{"Name": "broken", "Cmd": ["false"]}
+	]`
+	rtx.Must(ioutil.WriteFile(dir+"/config.json", []byte(config), 0o666), "failed to write config")
+	*configFile = dir + "/config.json"
+	*datadir = dir + "/data"
+	*schemaDir = dir + "/datatypes"
+	*schemaFile = dir + "/does-not-exist.json"
+	*dryRun = true
+	defer func() { *dryRun = false }()
+
+	// Run main. It would crash if it tried to copy the missing schema file.
+	out := mainStdout(t)
+	for _, d := range []string{*datadir, *schemaDir} {
+		if _, err := os.Stat(d); err == nil {
+			t.Errorf("%v should not have been created by a dry run", d)
+		}
+	}
+
+	// The document is piped into tools like jq, so it must come first.
+	doc, summary, found := strings.Cut(string(out), "\n\n")
+	if !found {
+		t.Fatalf("main() printed %q, wanted a document and a summary", out)
+	}
+	var nodeinfo api.NodeInfoV1
+	rtx.Must(json.Unmarshal([]byte(doc), &nodeinfo), "failed to parse the printed document")
+	if len(nodeinfo.Commands) != 1 || nodeinfo.Commands[0].Name != "uname" {
+		t.Errorf("printed document = %#v, wanted only uname", nodeinfo)
+	}
+	for _, want := range []string{"NAME", "uname", "ok", "broken", "failed"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary %q does not contain %q", summary, want)
+		}
+	}
+
+	*configFile = dir + "/missing.json"
+	if runDryRun(ioutil.Discard) == nil {
+		t.Error("runDryRun() = nil, wanted error for a missing config")
+	}
+}
+
+func TestReportSmoketest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReportSmoketest")
+	rtx.Must(err, "failed to create tempdir")
+	defer os.RemoveAll(dir)
+	*junitFile = dir + "/junit.xml"
+	defer func() { *junitFile = "" }()
+
+	var out bytes.Buffer
+	passed := []data.Result{{Name: "uname"}}
+	if err := reportSmoketest(&out, passed); err != nil {
+		t.Errorf("reportSmoketest() = %v, wanted nil", err)
+	}
+	failed := append(passed, data.Result{Name: "lshw", Err: errors.New("not found")})
+	if err := reportSmoketest(&out, failed); err == nil {
+		t.Error("reportSmoketest() = nil, wanted error")
+	}
+	report, err := os.ReadFile(*junitFile)
+	rtx.Must(err, "the JUnit report was not written")
+	if !strings.Contains(string(report), `failures="1"`) {
+		t.Errorf("JUnit report %s does not record the failure", report)
+	}
+	if !strings.Contains(out.String(), "not found") {
+		t.Errorf("report %q does not contain the error", out.String())
+	}
+
+	*junitFile = dir + "/does/not/exist/junit.xml"
+	if reportSmoketest(&out, passed) == nil {
+		t.Error("reportSmoketest() = nil, wanted error for an unwritable report")
+	}
+}
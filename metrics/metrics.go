@@ -32,6 +32,30 @@ var (
 		},
 		[]string{"datatype"},
 	)
+	GatherCPUTime = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gather_command_cpu_seconds",
+			Help:    "How much CPU time each command used in seconds, by mode",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		},
+		[]string{"datatype", "mode"},
+	)
+	GatherMaxRSS = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gather_command_max_rss_bytes",
+			Help:    "The maximum resident set size of each command in bytes",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 2, 12),
+		},
+		[]string{"datatype"},
+	)
+	GatherBlockOperations = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gather_command_block_operations",
+			Help:    "The number of block I/O operations of each command, by direction",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		},
+		[]string{"datatype", "direction"},
+	)
 	ConfigLoadTime = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "config_load_timestamp",
@@ -50,6 +74,56 @@ var (
 			Help: "The number of times the config has not been reloaded, even after reload was requested",
 		},
 	)
+	RedactionsApplied = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redactions_applied_total",
+			Help: "The number of matches redacted from the output of each gather command",
+		},
+		[]string{"datatype", "action"},
+	)
+	SinkErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sink_error_total",
+			Help: "The number of times writing gathered data to each sink has failed, by sink name such as jsonl:<filename> or the URL",
+		},
+		[]string{"sink"},
+	)
+	PolicyViolations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "policy_violation_total",
+			Help: "The number of commands refused by the command policy, when the config was loaded or right before running",
+		},
+		[]string{"stage"},
+	)
+	JanitorDeletedFiles = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "janitor_deleted_files_total",
+			Help: "The number of saved files deleted to enforce local retention limits",
+		},
+		[]string{"reason"},
+	)
+	JanitorDeletedBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "janitor_deleted_bytes_total",
+			Help: "The number of bytes of saved files deleted to enforce local retention limits",
+		},
+		[]string{"reason"},
+	)
+	JanitorDeletedDirs = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "janitor_deleted_directories_total",
+			Help: "The number of empty directories deleted after enforcing local retention limits",
+		},
+	)
+	// TimeSynchronized is only exported once a timesync gatherer has run, so
+	// that nodes which haven't checked their clock don't look unsynchronized.
+	TimeSynchronized = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "time_synchronized",
+			Help: "Whether the kernel clock was synchronized when last collected, 1 if it was and 0 if not",
+		},
+		[]string{"datatype"},
+	)
 )
 
 func init() {
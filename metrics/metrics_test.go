@@ -11,5 +11,14 @@ func TestMetrics(t *testing.T) {
 	GatherRuns.WithLabelValues("test").Add(1)
 	GatherErrors.WithLabelValues("test").Add(1)
 	GatherRuntime.WithLabelValues("test").Observe(1)
+	GatherCPUTime.WithLabelValues("test", "test").Observe(1)
+	GatherMaxRSS.WithLabelValues("test").Observe(1)
+	GatherBlockOperations.WithLabelValues("test", "test").Observe(1)
+	RedactionsApplied.WithLabelValues("test", "test").Add(1)
+	SinkErrors.WithLabelValues("test").Add(1)
+	PolicyViolations.WithLabelValues("test").Add(1)
+	JanitorDeletedFiles.WithLabelValues("test").Add(1)
+	JanitorDeletedBytes.WithLabelValues("test").Add(1)
+	TimeSynchronized.WithLabelValues("test").Set(1)
 	promtest.LintMetrics(t)
 }